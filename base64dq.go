@@ -8,8 +8,11 @@ package base64dq
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"math/bits"
 	"strconv"
+	"strings"
 	"sync"
 	"unicode/utf8"
 )
@@ -21,83 +24,131 @@ const (
 )
 
 // node is a node in a DFA (Deterministic Finite State Machine).
+// The children of the node are indexed by the byte minus lo.
+// The states at the start of runes have all 256 children,
+// and the states in the middle of runes have only 64 children for
+// the continuation bytes of UTF-8 (0x80-0xBF) to save memory.
 type node struct {
 	v        int
+	lo       byte
 	children []*node
 }
 
-func buildDFA(entries [64]string, padding rune) *node {
-	root := &node{
-		v:        rootNode,
-		children: make([]*node, 256),
+// next returns the state after n reads b, or nil if b is unexpected.
+func (n *node) next(b byte) *node {
+	i := int(b) - int(n.lo)
+	if uint(i) < uint(len(n.children)) {
+		return n.children[i]
 	}
-	for i, entry := range entries {
-		n := root
-		for _, b := range []byte(entry[:len(entry)-1]) {
-			if n.children[b] == nil {
-				n.children[b] = &node{
-					v:        midNode,
-					children: make([]*node, 256),
-				}
+	return nil
+}
+
+// insert adds the path of s to the DFA rooted at n, and connects the last byte of s to leaf.
+// s must be a valid UTF-8 encoded rune.
+func (n *node) insert(s string, leaf *node) {
+	for _, b := range []byte(s[:len(s)-1]) {
+		next := n.next(b)
+		if next == nil {
+			next = &node{
+				v:        midNode,
+				lo:       0x80,
+				children: make([]*node, 0x40),
 			}
-			n = n.children[b]
+			n.children[int(b)-int(n.lo)] = next
 		}
-		n.children[entry[len(entry)-1]] = &node{
+		n = next
+	}
+	b := s[len(s)-1]
+	n.children[int(b)-int(n.lo)] = leaf
+}
+
+// dfa is the state machine for decoding.
+type dfa struct {
+	once  sync.Once // guards root and trail
+	root  *node
+	trail *node
+}
+
+// buildDFA builds the DFA for decoding enc.
+// root is the initial state, and trail is the state after the final block.
+func buildDFA(enc *Encoding) (root, trail *node) {
+	root = &node{
+		v:        rootNode,
+		children: make([]*node, 256),
+	}
+	for i, entry := range enc.encode {
+		root.insert(entry, &node{
 			v:        i,
 			children: root.children,
-		}
+		})
+	}
+	for alias, r := range enc.aliases {
+		root.insert(string(alias), &node{
+			v:        enc.index(r),
+			children: root.children,
+		})
 	}
 
-	if padding != NoPadding {
+	ignore := enc.ignoredRunes()
+	for _, r := range ignore {
+		root.insert(string(r), root)
+	}
+
+	if padding := enc.padChar; padding != NoPadding {
 		pad := &node{
 			v:        paddingNode,
 			children: make([]*node, 256),
 		}
-		pad.children['\n'] = &node{
+		rest := &node{
 			v:        rootNode,
 			children: pad.children,
 		}
-		pad.children['\r'] = &node{
-			v:        rootNode,
-			children: pad.children,
+		for _, r := range ignore {
+			pad.insert(string(r), rest)
 		}
-
-		var buf [4]byte
-		l := utf8.EncodeRune(buf[:], padding)
-		n, m := root, pad
-		for _, b := range buf[:l-1] {
-			if n.children[b] == nil {
-				n.children[b] = &node{
-					v:        -1,
-					children: make([]*node, 256),
-				}
-			}
-			if m.children[b] == nil {
-				m.children[b] = &node{
-					v:        -1,
-					children: make([]*node, 256),
-				}
-			}
-			n = n.children[b]
-			m = m.children[b]
+		for _, r := range append([]rune{padding}, enc.decodePad...) {
+			root.insert(string(r), pad)
+			pad.insert(string(r), pad)
 		}
-		n.children[buf[l-1]] = pad
-		m.children[buf[l-1]] = pad
 	}
 
-	root.children['\n'] = root
-	root.children['\r'] = root
-	return root
+	// only ignored runes are allowed after the final block.
+	trail = &node{
+		v:        rootNode,
+		children: make([]*node, 256),
+	}
+	for _, r := range ignore {
+		trail.insert(string(r), trail)
+	}
+	return root, trail
 }
 
 type Encoding struct {
-	once sync.Once // guards root
-	root *node
-
-	encode  [64]string
-	maxSize int // maximum number of bytes per rune
-	padChar rune
-	strict  bool
+	dfa *dfa // shared with the derived encodings that decode in the same way
+
+	dmapOnce sync.Once // guards dmap
+	dmap     decodeMap // used by DecodeRunewise instead of the DFA
+
+	encode    [64]string
+	maxSize   int                    // maximum number of bytes per rune
+	runeSize  int                    // number of bytes per alphabet rune, or 0 if they vary
+	flat      [64 * utf8.UTFMax]byte // encode laid out every runeSize bytes, if runeSize > 0
+	padChar   rune
+	padBytes  []byte // padChar encoded in UTF-8, or empty if NoPadding
+	decodePad []rune // runes accepted as the padding by the decoder, in addition to padChar
+	strict    bool
+	ignore    []rune        // runes skipped by the decoder, in addition to CR and LF
+	aliases   map[rune]rune // runes decoded as the alphabet rune they map to
+	compose   bool          // whether the decoder composes combining kana marks
+
+	ignoreInvalid bool // whether the decoder skips the runes that it doesn't accept
+	noWhitespace  bool // whether the decoder rejects CR and LF
+	skipBOM       bool // whether the decoder skips a leading byte order mark
+	constantTime  bool // whether Decode runs in constant time
+	concat        bool // whether the decoder continues after the padding
+	singlePad     bool // whether one padding rune ends any partial final block
+
+	checksum func([]byte) byte // checksum appended to the data, or nil
 }
 
 // Strict creates a new encoding identical to enc except with
@@ -105,94 +156,621 @@ type Encoding struct {
 // trailing padding bits are zero.
 //
 // Note that the input is still malleable, as new line characters
-// (CR and LF) are still ignored.
+// (CR and LF) are still ignored. Use StrictNoWhitespace to reject them.
 func (enc *Encoding) Strict() *Encoding {
+	e := enc.Clone()
+	e.strict = true
+	e.dfa = enc.dfa // strictness doesn't change the DFA.
+	return e
+}
+
+// NonStrict creates a new encoding identical to enc except with
+// strict decoding disabled, undoing Strict.
+// The decoder accepts non-zero trailing padding bits again.
+// It doesn't change whether the decoder rejects CR and LF; see StrictNoWhitespace.
+func (enc *Encoding) NonStrict() *Encoding {
+	e := enc.Clone()
+	e.strict = false
+	e.dfa = enc.dfa // strictness doesn't change the DFA.
+	return e
+}
+
+// StrictNoWhitespace creates a new encoding identical to enc except
+// with strict decoding enabled, and the decoder rejects CR and LF
+// as invalid runes instead of ignoring them.
+// In this mode, exactly one input decodes to given data,
+// unless the runes are added by WithIgnoredRunes or WithAliases.
+func (enc *Encoding) StrictNoWhitespace() *Encoding {
+	e := enc.Clone()
+	e.strict = true
+	e.noWhitespace = true
+	return e
+}
+
+// ignoredRunes returns the runes that the decoder skips.
+func (enc *Encoding) ignoredRunes() []rune {
+	if enc.noWhitespace {
+		return enc.ignore
+	}
+	return append([]rune{'\n', '\r'}, enc.ignore...)
+}
+
+// Clone returns a copy of enc.
+// The copy builds its own decoding state machine,
+// so it is safe to use concurrently with the original.
+func (enc *Encoding) Clone() *Encoding {
 	return &Encoding{
-		encode:  enc.encode,
-		maxSize: enc.maxSize,
-		padChar: enc.padChar,
-		strict:  true,
+		dfa:       new(dfa),
+		encode:    enc.encode,
+		maxSize:   enc.maxSize,
+		runeSize:  enc.runeSize,
+		flat:      enc.flat,
+		padChar:   enc.padChar,
+		padBytes:  enc.padBytes,
+		decodePad: enc.decodePad,
+		strict:    enc.strict,
+		ignore:    enc.ignore,
+		aliases:   enc.aliases,
+		compose:   enc.compose,
+
+		ignoreInvalid: enc.ignoreInvalid,
+		noWhitespace:  enc.noWhitespace,
+		skipBOM:       enc.skipBOM,
+		constantTime:  enc.constantTime,
+		concat:        enc.concat,
+		singlePad:     enc.singlePad,
+
+		checksum: enc.checksum,
+	}
+}
+
+// Equal reports whether enc and other encode and decode in the same way.
+// It compares the alphabet, the padding, the strictness,
+// and the runes that the decoders additionally accept.
+func (enc *Encoding) Equal(other *Encoding) bool {
+	if enc == other {
+		return true
+	}
+	if enc == nil || other == nil {
+		return false
+	}
+	if enc.encode != other.encode ||
+		enc.padChar != other.padChar ||
+		enc.strict != other.strict ||
+		enc.compose != other.compose ||
+		enc.ignoreInvalid != other.ignoreInvalid ||
+		enc.noWhitespace != other.noWhitespace ||
+		enc.skipBOM != other.skipBOM ||
+		enc.concat != other.concat ||
+		enc.singlePad != other.singlePad {
+		return false
+	}
+	if enc.checksum != nil || other.checksum != nil {
+		// functions are not comparable.
+		return false
+	}
+	if !containsAll(enc.ignore, other.ignore) || !containsAll(other.ignore, enc.ignore) {
+		return false
+	}
+	if !containsAll(enc.decodePad, other.decodePad) || !containsAll(other.decodePad, enc.decodePad) {
+		return false
+	}
+	if len(enc.aliases) != len(other.aliases) {
+		return false
+	}
+	for alias, r := range enc.aliases {
+		if o, ok := other.aliases[alias]; !ok || o != r {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAll reports whether s contains all the runes in t.
+func containsAll(s, t []rune) bool {
+LOOP:
+	for _, r := range t {
+		for _, c := range s {
+			if c == r {
+				continue LOOP
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// WithIgnoredRunes creates a new encoding identical to enc except
+// that the decoder also skips the given runes anywhere in the input,
+// in the same way as CR and LF.
+// The runes must be valid, and must not be already accepted by the decoder,
+// e.g. contained in the encoding's alphabet or be the padding character.
+func (enc *Encoding) WithIgnoredRunes(runes ...rune) *Encoding {
+	for _, r := range runes {
+		if !utf8.ValidRune(r) {
+			panic("invalid ignored rune")
+		}
+		if enc.accepts(r) {
+			panic("ignored rune already accepted by the encoding")
+		}
+	}
+
+	e := enc.Clone()
+	e.ignore = make([]rune, 0, len(enc.ignore)+len(runes))
+	e.ignore = append(e.ignore, enc.ignore...)
+	e.ignore = append(e.ignore, runes...)
+	return e
+}
+
+// FormattingRunes is the set of invisible formatting runes
+// that rich-text editors and web pages often inject into copied text:
+// the zero-width spaces and joiners, the directional marks, embeddings and isolates,
+// the word joiner, the soft hyphen, and the zero-width no-break space (U+FEFF).
+var FormattingRunes = []rune{
+	'\u00AD', // SOFT HYPHEN
+	'\u061C', // ARABIC LETTER MARK
+	'\u200B', // ZERO WIDTH SPACE
+	'\u200C', // ZERO WIDTH NON-JOINER
+	'\u200D', // ZERO WIDTH JOINER
+	'\u200E', // LEFT-TO-RIGHT MARK
+	'\u200F', // RIGHT-TO-LEFT MARK
+	'\u202A', // LEFT-TO-RIGHT EMBEDDING
+	'\u202B', // RIGHT-TO-LEFT EMBEDDING
+	'\u202C', // POP DIRECTIONAL FORMATTING
+	'\u202D', // LEFT-TO-RIGHT OVERRIDE
+	'\u202E', // RIGHT-TO-LEFT OVERRIDE
+	'\u2060', // WORD JOINER
+	'\u2066', // LEFT-TO-RIGHT ISOLATE
+	'\u2067', // RIGHT-TO-LEFT ISOLATE
+	'\u2068', // FIRST STRONG ISOLATE
+	'\u2069', // POP DIRECTIONAL ISOLATE
+	'\uFEFF', // ZERO WIDTH NO-BREAK SPACE
+}
+
+// WithIgnoredFormatting creates a new encoding identical to enc except
+// that the decoder also skips FormattingRunes anywhere in the input,
+// so that the data survives a round trip through rich-text editors.
+// The formatting runes that the decoder already accepts are left as they are.
+func (enc *Encoding) WithIgnoredFormatting() *Encoding {
+	runes := make([]rune, 0, len(FormattingRunes))
+	for _, r := range FormattingRunes {
+		if !enc.accepts(r) {
+			runes = append(runes, r)
+		}
 	}
+	return enc.WithIgnoredRunes(runes...)
+}
+
+// WithAliases creates a new encoding identical to enc except
+// that the decoder also accepts the keys of aliases,
+// and decodes them as the alphabet runes they map to.
+// The encoder still emits the alphabet runes.
+// For example, the following encoding accepts ASCII digits as well as full-width digits:
+//
+//	NameEncoding.WithAliases(map[rune]rune{'0': '０', '1': '１', ...})
+//
+// The keys must be valid runes that are not already accepted by the decoder,
+// and the values must be contained in the encoding's alphabet.
+func (enc *Encoding) WithAliases(aliases map[rune]rune) *Encoding {
+	for alias, r := range aliases {
+		if !utf8.ValidRune(alias) {
+			panic("invalid alias")
+		}
+		if enc.accepts(alias) {
+			panic("alias already accepted by the encoding")
+		}
+		if enc.index(r) < 0 {
+			panic("alias target not contained in alphabet")
+		}
+	}
+
+	e := enc.Clone()
+	e.aliases = make(map[rune]rune, len(enc.aliases)+len(aliases))
+	for alias, r := range enc.aliases {
+		e.aliases[alias] = r
+	}
+	for alias, r := range aliases {
+		e.aliases[alias] = r
+	}
+	return e
+}
+
+// WithCaseFolding creates a new encoding identical to enc except
+// that the decoder also accepts the opposite case of the ASCII letters in the alphabet,
+// if the opposite case is not already accepted by the decoder.
+// For example, if the alphabet contains 'A' but not 'a', 'a' is decoded as 'A'.
+// The encoder still emits the alphabet runes.
+// It is a no-op for the alphabets without ASCII letters, such as that of StdEncoding.
+func (enc *Encoding) WithCaseFolding() *Encoding {
+	aliases := map[rune]rune{}
+	for _, s := range enc.encode {
+		r, _ := utf8.DecodeRuneInString(s)
+		var o rune
+		switch {
+		case 'A' <= r && r <= 'Z':
+			o = r + 'a' - 'A'
+		case 'a' <= r && r <= 'z':
+			o = r - 'a' + 'A'
+		default:
+			continue
+		}
+		if !enc.accepts(o) {
+			aliases[o] = r
+		}
+	}
+	return enc.WithAliases(aliases)
+}
+
+// index returns the index of r in the alphabet of enc, or -1 if r is not in the alphabet.
+func (enc *Encoding) index(r rune) int {
+	for i, s := range enc.encode {
+		if c, _ := utf8.DecodeRuneInString(s); c == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// contains reports whether r is in the alphabet of enc.
+func (enc *Encoding) contains(r rune) bool {
+	return enc.index(r) >= 0
+}
+
+// accepts reports whether the decoder of enc already gives a meaning to r.
+func (enc *Encoding) accepts(r rune) bool {
+	if r == '\r' || r == '\n' || r == enc.padChar || enc.contains(r) {
+		return true
+	}
+	for _, c := range enc.ignore {
+		if c == r {
+			return true
+		}
+	}
+	for _, c := range enc.decodePad {
+		if c == r {
+			return true
+		}
+	}
+	_, ok := enc.aliases[r]
+	return ok
 }
 
 const encodeStd = "あいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわがぎぐげござじずぜぞだぢづでどばびぶべぼ"
+const encodeKatakana = "アイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワガギグゲゴザジズゼゾダヂヅデドバビブベボ"
+const encodeHankakuKatakana = "ｱｲｳｴｵｶｷｸｹｺｻｼｽｾｿﾀﾁﾂﾃﾄﾅﾆﾇﾈﾉﾊﾋﾌﾍﾎﾏﾐﾑﾒﾓﾔﾕﾖﾗﾘﾙﾚﾛﾜｦﾝｧｨｩｪｫｯｬｭｮｰﾞﾟ｡｢｣､￭￮"
+const encodeEmoji = "😀😁😂😃😄😅😆😇😈😉😊😋😌😍😎😏😐😑😒😓😔😕😖😗😘😙😚😛😜😝😞😟😠😡😢😣😤😥😦😧😨😩😪😫😬😭😮😯😰😱😲😳😴😵😶😷😸😹😺😻😼😽😾😿"
+const encodeURL = "あいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわゐゑをんぁぃぅぇぉっゃゅょゎゕゖーゝ〆〇"
 const encodeName = "０１２３４５６７８９あいうえおかきくけこさしすせそたちつてとなにぬねのはひふへほまみむめもやゆよらりるれろわをんっゃゅょ゛゜ー　"
 
 const (
-	StdPadding rune = '・' // Standard padding character
-	NoPadding  rune = -1  // No padding
+	StdPadding     rune = '・' // Standard padding character
+	HankakuPadding rune = '･' // Half-width padding character
+	NoPadding      rune = -1  // No padding
 )
 
-// NewEncoding returns a new padded Encoding defined by the given alphabet.
+// NewEncoding returns a new padded Encoding defined by the given alphabet,
+// which must be a 64-rune string that does not contain the padding character
+// or CR / LF ('\r', '\n').
+// It panics if the alphabet is invalid; use NewEncodingErr to get an error instead.
 func NewEncoding(encoder string) *Encoding {
-	e := &Encoding{
-		padChar: StdPadding,
-		maxSize: 1,
+	e, err := NewEncodingErr(encoder)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// NewEncodingErr is like NewEncoding but returns an error
+// instead of panicking if the alphabet is invalid.
+func NewEncodingErr(encoder string) (*Encoding, error) {
+	if err := ValidAlphabet(encoder); err != nil {
+		return nil, err
 	}
 
 	var pos [65]int
 	j := 0
-	for i, ch := range encoder {
-		if j >= 64 {
-			panic("encoding alphabet is not 64-runes long")
-		}
-		if ch == utf8.RuneError {
-			panic("encoding alphabet contains invalid UTF-8 sequence")
-		}
+	for i := range encoder {
 		pos[j] = i
 		j++
 	}
 	pos[64] = len(encoder)
 
+	e := &Encoding{
+		dfa:      new(dfa),
+		padChar:  StdPadding,
+		padBytes: []byte(string(StdPadding)),
+		maxSize:  1,
+		runeSize: pos[1] - pos[0],
+	}
 	for i := 0; i < 64; i++ {
 		e.encode[i] = encoder[pos[i]:pos[i+1]]
-		if size := pos[i+1] - pos[i]; size > e.maxSize {
+		size := pos[i+1] - pos[i]
+		if size > e.maxSize {
 			e.maxSize = size
 		}
+		if size != e.runeSize {
+			e.runeSize = 0
+		}
+	}
+	for i, s := range e.encode {
+		if e.runeSize > 0 {
+			copy(e.flat[i*e.runeSize:], s)
+		}
 	}
 	if size := utf8.RuneLen(e.padChar); size > e.maxSize {
 		e.maxSize = size
 	}
 
+	return e, nil
+}
+
+// ValidAlphabet checks whether s is a valid alphabet for NewEncoding.
+// A valid alphabet is a valid UTF-8 string of 64 distinct runes,
+// and doesn't contain the padding character or CR / LF ('\r', '\n').
+// It returns an error describing the first violation, or nil if s is valid.
+func ValidAlphabet(s string) error {
+	seen := make(map[rune]struct{}, 64)
+	j := 0
+	for _, ch := range s {
+		if j >= 64 {
+			return alphabetLengthError(utf8.RuneCountInString(s))
+		}
+		if ch == utf8.RuneError {
+			return fmt.Errorf("base64dq: encoding alphabet contains invalid UTF-8 sequence at rune index %d", j)
+		}
+		if ch == StdPadding || ch == '\r' || ch == '\n' {
+			return fmt.Errorf("base64dq: encoding alphabet contains invalid rune %q at rune index %d", ch, j)
+		}
+		if _, ok := seen[ch]; ok {
+			return fmt.Errorf("base64dq: encoding alphabet contains duplicated rune %q at rune index %d", ch, j)
+		}
+		seen[ch] = struct{}{}
+		j++
+	}
+	if j < 64 {
+		return alphabetLengthError(j)
+	}
+	return nil
+}
+
+// alphabetLengthError returns the error for an alphabet of n runes.
+func alphabetLengthError(n int) error {
+	return fmt.Errorf("base64dq: encoding alphabet is not 64-runes long: expected 64 runes, got %d", n)
+}
+
+// NewEncodingFromRunes is like NewEncoding but takes the alphabet as a slice of 64 runes.
+// It panics if the alphabet is invalid; use NewEncodingFromRunesErr to get an error instead.
+func NewEncodingFromRunes(runes []rune) *Encoding {
+	e, err := NewEncodingFromRunesErr(runes)
+	if err != nil {
+		panic(err)
+	}
 	return e
 }
 
-func (enc *Encoding) buildOnce() {
-	enc.once.Do(enc.build)
+// NewEncodingFromRunesErr is like NewEncodingFromRunes but returns an error
+// instead of panicking if the alphabet is invalid.
+func NewEncodingFromRunesErr(runes []rune) (*Encoding, error) {
+	if len(runes) != 64 {
+		return nil, alphabetLengthError(len(runes))
+	}
+	for i, r := range runes {
+		if !utf8.ValidRune(r) {
+			return nil, fmt.Errorf("base64dq: encoding alphabet contains invalid rune %U at rune index %d", r, i)
+		}
+	}
+	return NewEncodingErr(string(runes))
+}
+
+func (enc *Encoding) buildOnce() *dfa {
+	d := enc.dfa
+	d.once.Do(func() {
+		d.root, d.trail = buildDFA(enc)
+	})
+	return d
+}
+
+// Prebuild builds the state machine for decoding in advance.
+// The decoders build it on first use, so calling Prebuild at startup
+// avoids the latency of the first decoding.
+// It is safe to call Prebuild concurrently and multiple times.
+func (enc *Encoding) Prebuild() {
+	enc.buildOnce()
 }
 
-func (enc *Encoding) build() {
-	enc.root = buildDFA(enc.encode, enc.padChar)
+// DFAStats reports the size of the state machine for decoding:
+// the number of its states and the approximate number of bytes they use.
+// It builds the state machine if it has not been built yet.
+// The encodings derived from enc that decode in the same way share
+// the state machine, so they report the same numbers.
+// DecodeRunewise doesn't use the state machine.
+func (enc *Encoding) DFAStats() (nodes, bytes int) {
+	return enc.buildOnce().stats()
+}
+
+// stats returns the number of the nodes reachable from the root and the trail,
+// and the approximate number of bytes they use.
+func (d *dfa) stats() (nodes, bytes int) {
+	const (
+		wordSize = strconv.IntSize / 8
+		nodeSize = 5 * wordSize // v, lo and the slice header of children
+	)
+	seen := make(map[*node]bool)
+	tables := make(map[**node]bool) // the children shared by several nodes are counted once
+	stack := []*node{d.root, d.trail}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == nil || seen[n] {
+			continue
+		}
+		seen[n] = true
+		nodes++
+		bytes += nodeSize
+		if len(n.children) == 0 || tables[&n.children[0]] {
+			continue
+		}
+		tables[&n.children[0]] = true
+		bytes += cap(n.children) * wordSize
+		stack = append(stack, n.children...)
+	}
+	return nodes, bytes
 }
 
 // WithPadding creates a new encoding identical to enc except
 // with a specified padding character, or NoPadding to disable padding.
 // The padding character must not be '\r' or '\n', must not
 // be contained in the encoding's alphabet.
+// It panics if the padding is invalid; use WithPaddingErr to get an error instead.
 func (enc *Encoding) WithPadding(padding rune) *Encoding {
+	e, err := enc.WithPaddingErr(padding)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// WithPaddingErr is like WithPadding but returns an error
+// instead of panicking if the padding is invalid.
+func (enc *Encoding) WithPaddingErr(padding rune) (*Encoding, error) {
 	if padding == '\r' || padding == '\n' {
-		panic("invalid padding")
+		return nil, fmt.Errorf("base64dq: invalid padding rune %q", padding)
 	}
 
-	for _, s := range enc.encode {
+	for i, s := range enc.encode {
 		r, _ := utf8.DecodeRuneInString(s)
 		if r == padding {
-			panic("padding contained in alphabet")
+			return nil, fmt.Errorf("base64dq: padding rune %q present in alphabet at index %d", padding, i)
 		}
 	}
+	for _, r := range enc.ignore {
+		if r == padding {
+			return nil, fmt.Errorf("base64dq: padding rune %q present in ignored runes", padding)
+		}
+	}
+	if _, ok := enc.aliases[padding]; ok {
+		return nil, fmt.Errorf("base64dq: padding rune %q present in aliases", padding)
+	}
 
-	maxSize := enc.maxSize
-	size := utf8.RuneLen(padding)
-	if size > maxSize {
+	// The old padding may be the longest rune, so count the alphabet again.
+	maxSize := 1
+	for _, s := range enc.encode {
+		if len(s) > maxSize {
+			maxSize = len(s)
+		}
+	}
+	if size := utf8.RuneLen(padding); size > maxSize {
 		maxSize = size
 	}
+	if padding != NoPadding {
+		for _, r := range enc.decodePad {
+			if size := utf8.RuneLen(r); size > maxSize {
+				maxSize = size
+			}
+		}
+	}
 
-	return &Encoding{
-		encode:  enc.encode,
-		maxSize: maxSize,
-		padChar: padding,
-		strict:  enc.strict,
+	e := enc.Clone()
+	e.maxSize = maxSize
+	e.padChar = padding
+	e.padBytes = nil
+	if padding != NoPadding {
+		e.padBytes = []byte(string(padding))
+	} else {
+		e.singlePad = false
+	}
+	e.decodePad = nil
+	if padding != NoPadding {
+		// padding may be one of the additional padding runes.
+		for _, r := range enc.decodePad {
+			if r != padding {
+				e.decodePad = append(e.decodePad, r)
+			}
+		}
+	}
+	if padding == enc.padChar {
+		e.dfa = enc.dfa
+	}
+	return e, nil
+}
+
+// WithDecodePadding creates a new encoding identical to enc except
+// that the decoder also accepts the given runes as the padding.
+// The encoder still emits the padding character of enc.
+// For example, the following encoding accepts both '・' and '=' as the padding:
+//
+//	StdEncoding.WithDecodePadding('=')
+//
+// The runes must be valid, and must not be already accepted by the decoder.
+// It panics if enc has no padding.
+// The padding runes are dropped by WithPadding(NoPadding).
+func (enc *Encoding) WithDecodePadding(runes ...rune) *Encoding {
+	if enc.padChar == NoPadding {
+		panic("decode padding on the encoding without padding")
+	}
+	maxSize := enc.maxSize
+	for _, r := range runes {
+		if !utf8.ValidRune(r) {
+			panic("invalid padding rune")
+		}
+		if enc.accepts(r) {
+			panic("padding rune already accepted by the encoding")
+		}
+		if size := utf8.RuneLen(r); size > maxSize {
+			maxSize = size
+		}
+	}
+
+	e := enc.Clone()
+	e.maxSize = maxSize
+	e.decodePad = make([]rune, 0, len(enc.decodePad)+len(runes))
+	e.decodePad = append(e.decodePad, enc.decodePad...)
+	e.decodePad = append(e.decodePad, runes...)
+	return e
+}
+
+// Alphabet returns the 64-rune alphabet of enc,
+// in the same form as passed to NewEncoding.
+func (enc *Encoding) Alphabet() string {
+	n := 0
+	for _, s := range enc.encode {
+		n += len(s)
+	}
+	buf := make([]byte, 0, n)
+	for _, s := range enc.encode {
+		buf = append(buf, s...)
+	}
+	return string(buf)
+}
+
+// PaddingChar returns the padding character of enc,
+// or NoPadding if padding is disabled.
+func (enc *Encoding) PaddingChar() rune {
+	return enc.padChar
+}
+
+// IsStrict reports whether enc decodes in strict mode,
+// i.e. it was created by Strict or StrictNoWhitespace.
+func (enc *Encoding) IsStrict() bool {
+	return enc.strict
+}
+
+// MaxRuneLen returns the maximum number of bytes of the runes that enc emits or accepts,
+// i.e. the alphabet runes and the padding.
+// EncodedLen assumes that every rune is MaxRuneLen bytes long.
+func (enc *Encoding) MaxRuneLen() int {
+	return enc.maxSize
+}
+
+// String returns a human-readable description of enc for debugging,
+// such as base64dq.Encoding(alphabet="あいう…", pad='・', strict=false).
+// It doesn't build the state machine for decoding.
+func (enc *Encoding) String() string {
+	pad := "none"
+	if enc.padChar != NoPadding {
+		pad = strconv.QuoteRune(enc.padChar)
 	}
+	return fmt.Sprintf("base64dq.Encoding(alphabet=%q, pad=%s, strict=%t)", enc.Alphabet(), pad, enc.strict)
 }
 
 // StdEncoding is a base64 encoding used in Revival Password.
@@ -201,19 +779,103 @@ var StdEncoding = NewEncoding(encodeStd)
 // NameEncoding is a base64 encoding used in encoding a user name.
 var NameEncoding = NewEncoding(encodeName)
 
+// KatakanaEncoding is the katakana counterpart of StdEncoding.
+var KatakanaEncoding = NewEncoding(encodeKatakana)
+
+// HankakuKatakanaEncoding is a base64 encoding using half-width katakana,
+// padded with HankakuPadding.
+var HankakuKatakanaEncoding = NewEncoding(encodeHankakuKatakana).WithPadding(HankakuPadding)
+
+// EmojiEncoding is a base64 encoding using the 64 emoji from U+1F600 (GRINNING FACE)
+// through U+1F63F (WEEPING CAT FACE) in order, padded with StdPadding.
+// Every rune of the alphabet is 4 bytes long in UTF-8.
+// The alphabet is stable and will not change.
+var EmojiEncoding = NewEncoding(encodeEmoji)
+
+// URLEncoding is a base64 encoding whose alphabet is safe in URLs and filenames,
+// padded with StdPadding.
+// The alphabet consists of the hiragana without the voiced sound marks,
+// the small hiragana, and "ー", "ゝ", "〆" and "〇".
+// None of them is a reserved character in URLs or is forbidden in filenames,
+// and none of them is changed by the Unicode normalization,
+// unlike "が" of StdEncoding, which macOS decomposes into "か" and U+3099 in filenames.
+// They are still percent-encoded in the URLs that allow only ASCII,
+// but url.PathUnescape restores them as they are.
+// Every rune of the alphabet is 3 bytes long in UTF-8.
+var URLEncoding = NewEncoding(encodeURL)
+
 // RawStdEncoding is the standard raw, unpadded base64 encoding.
 var RawStdEncoding = StdEncoding.WithPadding(NoPadding)
 
 // RawNameEncoding is the name raw, unpadded base64 encoding.
 var RawNameEncoding = NameEncoding.WithPadding(NoPadding)
 
+// RawKatakanaEncoding is the katakana raw, unpadded base64 encoding.
+var RawKatakanaEncoding = KatakanaEncoding.WithPadding(NoPadding)
+
+// RawHankakuKatakanaEncoding is the half-width katakana raw, unpadded base64 encoding.
+var RawHankakuKatakanaEncoding = HankakuKatakanaEncoding.WithPadding(NoPadding)
+
+// RawURLEncoding is the URL and filename safe raw, unpadded base64 encoding.
+var RawURLEncoding = URLEncoding.WithPadding(NoPadding)
+
+// RawEmojiEncoding is the emoji raw, unpadded base64 encoding.
+var RawEmojiEncoding = EmojiEncoding.WithPadding(NoPadding)
+
+// encodeFixed encodes the complete blocks in src using the flat table.
+// It is a fast path of Encode for the alphabets whose runes have the same length.
+func (enc *Encoding) encodeFixed(dst, src []byte) int {
+	w := enc.runeSize
+	t := enc.flat[:64*w]
+	di := 0
+	for si := 0; si+3 <= len(src); si += 3 {
+		val := uint(src[si+0])<<16 | uint(src[si+1])<<8 | uint(src[si+2])
+		i0, i1, i2, i3 := int(val>>18&0x3F)*w, int(val>>12&0x3F)*w, int(val>>6&0x3F)*w, int(val&0x3F)*w
+		if w == 3 {
+			// fast path for most Japanese kana
+			d := dst[di : di+12]
+			d[0], d[1], d[2] = t[i0], t[i0+1], t[i0+2]
+			d[3], d[4], d[5] = t[i1], t[i1+1], t[i1+2]
+			d[6], d[7], d[8] = t[i2], t[i2+1], t[i2+2]
+			d[9], d[10], d[11] = t[i3], t[i3+1], t[i3+2]
+		} else {
+			copy(dst[di:], t[i0:i0+w])
+			copy(dst[di+w:], t[i1:i1+w])
+			copy(dst[di+2*w:], t[i2:i2+w])
+			copy(dst[di+3*w:], t[i3:i3+w])
+		}
+		di += 4 * w
+	}
+	return di
+}
+
 func (enc *Encoding) Encode(dst, src []byte) int {
+	if enc.checksum == nil {
+		return enc.encodeData(dst, src)
+	}
+
+	// encode the complete blocks as is, and the final partial block with the checksum
+	// from the stack, so that src is not copied.
+	sum := enc.checksum(src)
+	n := (len(src) / 3) * 3
+	di := enc.encodeData(dst, src[:n])
+	var buf [3]byte
+	k := copy(buf[:], src[n:])
+	buf[k] = sum
+	return di + enc.encodeData(dst[di:], buf[:k+1])
+}
+
+// encodeData is Encode without the checksum.
+func (enc *Encoding) encodeData(dst, src []byte) int {
 	if len(src) == 0 {
 		return 0
 	}
 
 	di, si := 0, 0
 	n := (len(src) / 3) * 3
+	if enc.runeSize > 0 {
+		di, si = enc.encodeFixed(dst, src[:n]), n
+	}
 	for si < n {
 		val := uint(src[si+0])<<16 | uint(src[si+1])<<8 | uint(src[si+2])
 		di += copy(dst[di:], enc.encode[val>>18&0x3F])
@@ -239,136 +901,794 @@ func (enc *Encoding) Encode(dst, src []byte) int {
 	switch remain {
 	case 2:
 		di += copy(dst[di:], enc.encode[val>>6&0x3F])
-		if enc.padChar != NoPadding {
-			di += utf8.EncodeRune(dst[di:], enc.padChar)
-		}
+		di += copy(dst[di:], enc.padBytes)
 	case 1:
-		if enc.padChar != NoPadding {
-			di += utf8.EncodeRune(dst[di:], enc.padChar)
-			di += utf8.EncodeRune(dst[di:], enc.padChar)
+		di += copy(dst[di:], enc.padBytes)
+		if !enc.singlePad {
+			di += copy(dst[di:], enc.padBytes)
 		}
 	}
 	return di
 }
 
+// EncodeSafe is like Encode but returns ErrShortBuffer
+// instead of panicking if dst is shorter than EncodedLen(len(src)).
+func (enc *Encoding) EncodeSafe(dst, src []byte) (int, error) {
+	if len(dst) < enc.EncodedLen(len(src)) {
+		return 0, ErrShortBuffer
+	}
+	return enc.Encode(dst, src), nil
+}
+
+// AppendEncode appends the base64dq encoded src to dst
+// and returns the extended buffer.
+func (enc *Encoding) AppendEncode(dst, src []byte) []byte {
+	n := enc.EncodedLen(len(src))
+	dst = grow(dst, n)
+	n = enc.Encode(dst[len(dst):][:n], src)
+	return dst[:len(dst)+n]
+}
+
 func (enc *Encoding) EncodeToString(src []byte) string {
-	buf := make([]byte, enc.EncodedLen(len(src)))
+	buf := make([]byte, enc.EncodedLenExact(src))
 	n := enc.Encode(buf, src)
 	return string(buf[:n])
 }
 
+// EncodeBatch encodes each element of src, and returns the results in dst[:0],
+// growing it if needed.
+// All the results are stored in a single buffer allocated once per call,
+// instead of one allocation per element as EncodeToString does.
+//
+// The returned slices share the buffer, but their capacities are limited to their lengths,
+// so appending to one of them never overwrites the others.
+// The buffer is never reused by later calls, but the slice of the results is:
+// passing the returned slice as dst to the next call overwrites its elements.
+func (enc *Encoding) EncodeBatch(dst, src [][]byte) [][]byte {
+	total := 0
+	for _, s := range src {
+		total += enc.EncodedLenExact(s)
+	}
+	buf := make([]byte, total)
+	dst = dst[:0]
+	for _, s := range src {
+		n := enc.Encode(buf, s)
+		dst = append(dst, buf[:n:n])
+		buf = buf[n:]
+	}
+	return dst
+}
+
+// EncodeStringToString is like EncodeToString but takes the data as a string.
+// It encodes s in small chunks instead of converting the whole s to []byte,
+// so it doesn't copy s.
+func (enc *Encoding) EncodeStringToString(s string) string {
+	if enc.checksum != nil {
+		// the checksum needs the whole data.
+		return enc.EncodeToString([]byte(s))
+	}
+	var b strings.Builder
+	b.Grow(enc.EncodedLen(len(s)))
+	encodeToBuilder(enc, &b, s)
+	return b.String()
+}
+
+// EncodeToBuilder appends the base64dq encoded src to b.
+// It grows b by EncodedLen(len(src)) bytes first, and then encodes src
+// in small chunks through a buffer on the stack into b.
+// Unlike EncodeToString, it allocates no intermediate string.
+func (enc *Encoding) EncodeToBuilder(b *strings.Builder, src []byte) {
+	b.Grow(enc.EncodedLen(len(src)))
+	if enc.checksum == nil {
+		encodeToBuilder(enc, b, src)
+		return
+	}
+
+	// encode the full blocks as they are,
+	// and then the rest of src followed by the checksum.
+	sum := enc.checksum(src)
+	n := (len(src) / 3) * 3
+	encodeToBuilder(enc, b, src[:n])
+	var buf [3]byte
+	k := copy(buf[:], src[n:])
+	buf[k] = sum
+	encodeToBuilder(enc, b, buf[:k+1])
+}
+
+// encodeToBuilder encodes src into b.
+// The caller grows b beforehand.
+func encodeToBuilder[T string | []byte](enc *Encoding, b *strings.Builder, src T) {
+	// the chunks are multiples of 3 bytes, so only the last one is padded.
+	var in [3 * 64]byte
+	var out [4 * 64 * utf8.UTFMax]byte
+	for len(src) > 0 {
+		n := copy(in[:], src)
+		src = src[n:]
+		b.Write(out[:enc.encodeData(out[:], in[:n])])
+	}
+}
+
+// EncodeWriter encodes src and writes the result to w in a single Write call.
+// It returns the number of bytes written and any error from w.
+func (enc *Encoding) EncodeWriter(w io.Writer, src []byte) (int, error) {
+	buf := make([]byte, enc.EncodedLenExact(src))
+	n := enc.Encode(buf, src)
+	return w.Write(buf[:n])
+}
+
+// EncodeToFixedString is like EncodeToString but appends the padding characters
+// until the result is exactly runeLen runes long, e.g. 20 runes for the passwords of DQ1.
+// It returns an error if the encoding has no padding and the result is shorter than runeLen,
+// or if the result is already longer than runeLen.
+//
+// The padding characters beyond the final block are rejected by Decode,
+// so trim them before decoding.
+func (enc *Encoding) EncodeToFixedString(src []byte, runeLen int) (string, error) {
+	buf := make([]byte, enc.EncodedLenExact(src))
+	n := enc.Encode(buf, src)
+	buf = buf[:n]
+	count := utf8.RuneCount(buf)
+	if count > runeLen {
+		return "", fmt.Errorf("base64dq: encoded length %d exceeds %d runes", count, runeLen)
+	}
+	if count < runeLen && enc.padChar == NoPadding {
+		return "", fmt.Errorf("base64dq: cannot pad encoded length %d to %d runes without padding", count, runeLen)
+	}
+	for ; count < runeLen; count++ {
+		buf = append(buf, enc.padBytes...)
+	}
+	return string(buf), nil
+}
+
 // EncodedLen returns the length in bytes of the base64 encoding
 // of an input buffer of length n.
 func (enc *Encoding) EncodedLen(n int) int {
-	var ret int
+	return enc.EncodedRuneLen(n) * enc.maxSize // maximum # bytes: utf8.UTFMax bytes per char
+}
+
+// EncodedRuneLen returns the length in runes of the base64 encoding
+// of an input buffer of length n, including the padding.
+// It is the number of the characters that users see,
+// independent of the length of the runes in UTF-8.
+func (enc *Encoding) EncodedRuneLen(n int) int {
+	if enc.checksum != nil {
+		n++
+	}
 	if enc.padChar == NoPadding {
-		ret = (n*8 + 5) / 6 // minimum # chars at 6 bits per char
-	} else {
-		ret = (n + 2) / 3 * 4 // minimum # 4-char quanta, 3 bytes each
+		return (n*8 + 5) / 6 // minimum # chars at 6 bits per char
+	}
+	if enc.singlePad && n%3 != 0 {
+		return n/3*4 + n%3 + 2 // the partial final block has a single padding
 	}
-	return ret * enc.maxSize // maximum # bytes: utf8.UTFMax bytes per char
+	return (n + 2) / 3 * 4 // minimum # 4-char quanta, 3 bytes each
+}
+
+// EncodedLenExact returns the length in bytes of the base64 encoding of src.
+// If all the runes in the alphabet have the same length in UTF-8,
+// it is the exact length of the data Encode writes.
+// Otherwise, it falls back to EncodedLen(len(src)).
+func (enc *Encoding) EncodedLenExact(src []byte) int {
+	if enc.runeSize == 0 {
+		return enc.EncodedLen(len(src))
+	}
+	n := len(src)
+	if enc.checksum != nil {
+		n++
+	}
+	if enc.padChar == NoPadding {
+		return (n*8 + 5) / 6 * enc.runeSize
+	}
+	ret := n / 3 * 4 * enc.runeSize
+	switch n % 3 {
+	case 1:
+		ret += 2*enc.runeSize + len(enc.padBytes)
+		if !enc.singlePad {
+			ret += len(enc.padBytes)
+		}
+	case 2:
+		ret += 3*enc.runeSize + len(enc.padBytes)
+	}
+	return ret
 }
 
 type encoder struct {
 	err  error
 	enc  *Encoding
 	w    io.Writer
-	buf  [3]byte    // buffered data waiting to be encoded
-	nbuf int        // number of bytes in buf
-	out  [1024]byte // output buffer
+	buf  [3]byte // buffered data waiting to be encoded
+	nbuf int     // number of bytes in buf
+	out  []byte  // output buffer
+
+	// whether each Write calls w.Write at most once, see NewBlockEncoder.
+	block bool
+
+	pool *EncoderPool // the pool that the encoder returns to on Close, if any
 }
 
 func (e *encoder) Write(p []byte) (n int, err error) {
 	if e.err != nil {
 		return 0, e.err
 	}
+	if e.block {
+		return e.writeBlocks(p)
+	}
+
+	// Leading fringe.
+	if e.nbuf > 0 {
+		var i int
+		for i = 0; i < len(p) && e.nbuf < 3; i++ {
+			e.buf[e.nbuf] = p[i]
+			e.nbuf++
+		}
+		n += i
+		p = p[i:]
+		if e.nbuf < 3 {
+			return
+		}
+		size := e.enc.Encode(e.out, e.buf[:])
+		if _, e.err = e.w.Write(e.out[:size]); e.err != nil {
+			return n, e.err
+		}
+		e.nbuf = 0
+	}
+
+	// Large interior chunks.
+	for len(p) >= 3 {
+		nn := len(e.out) / e.enc.maxSize / 4 * 3
+		if nn > len(p) {
+			nn = len(p)
+			nn -= nn % 3
+		}
+		size := e.enc.Encode(e.out, p[:nn])
+		if _, e.err = e.w.Write(e.out[:size]); e.err != nil {
+			return n, e.err
+		}
+		n += nn
+		p = p[nn:]
+	}
+
+	// Trailing fringe.
+	copy(e.buf[:], p)
+	e.nbuf = len(p)
+	n += len(p)
+	return n, nil
+}
+
+// writeBlocks encodes the complete blocks of the pending bytes and p,
+// and writes them to e.w in a single call.
+func (e *encoder) writeBlocks(p []byte) (int, error) {
+	n := len(p)
+	if e.nbuf+len(p) < 3 {
+		e.nbuf += copy(e.buf[e.nbuf:], p)
+		return n, nil
+	}
+
+	if size := (e.nbuf + len(p)) / 3 * 4 * e.enc.maxSize; len(e.out) < size {
+		e.out = make([]byte, size)
+	}
+	k := 0
+	if e.nbuf > 0 {
+		i := copy(e.buf[e.nbuf:], p)
+		k = e.enc.Encode(e.out, e.buf[:])
+		p = p[i:]
+	}
+	m := len(p) - len(p)%3
+	k += e.enc.Encode(e.out[k:], p[:m])
+	e.nbuf = copy(e.buf[:], p[m:])
+	if _, e.err = e.w.Write(e.out[:k]); e.err != nil {
+		return 0, e.err
+	}
+	return n, nil
+}
+
+// Close flushes any pending output from the encoder.
+// It is an error to call Write after calling Close.
+func (e *encoder) Close() error {
+	// If there's anything left in the buffer, flush it out
+	if e.err == nil && e.nbuf > 0 {
+		size := e.enc.Encode(e.out, e.buf[:e.nbuf])
+		_, e.err = e.w.Write(e.out[:size])
+		e.nbuf = 0
+	}
+	err := e.err
+	if p := e.pool; p != nil {
+		e.pool = nil
+		e.w = nil
+		p.pool.Put(e)
+	}
+	return err
+}
+
+// Flush writes out the complete blocks written so far,
+// and flushes the underlying writer if it has a Flush method, such as *bufio.Writer.
+// The remaining 1 or 2 bytes are kept pending until the next Write or Close,
+// so the encoder can continue after Flush.
+func (e *encoder) Flush() error {
+	// Write encodes the complete blocks immediately,
+	// so only the underlying writer may have something to write.
+	if e.err != nil {
+		return e.err
+	}
+	return flush(e.w)
+}
+
+// flusher is implemented by writers that buffer their output.
+type flusher interface {
+	Flush() error
+}
+
+// flush flushes w if it implements flusher.
+func flush(w io.Writer) error {
+	if f, ok := w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Reset discards the encoder's state and makes it equivalent to
+// the result of NewEncoder with the same Encoding and w.
+func (e *encoder) Reset(w io.Writer) {
+	e.err = nil
+	e.w = w
+	e.buf = [3]byte{}
+	e.nbuf = 0
+}
+
+// Encoder is the interface implemented by the stream encoder returned by NewEncoder.
+type Encoder interface {
+	io.WriteCloser
+
+	// Reset discards the encoder's state and makes it write to w.
+	// This permits reusing an encoder rather than allocating a new one.
+	Reset(w io.Writer)
+
+	// Flush writes out the output of the complete blocks,
+	// keeping the incomplete block pending.
+	Flush() error
+}
+
+// NewEncoder returns a new base64 stream encoder.
+// The returned encoder implements Encoder, so it can be reused by Reset.
+func NewEncoder(enc *Encoding, w io.Writer) io.WriteCloser {
+	return NewEncoderSize(enc, w, encodeBufSize)
+}
+
+// encodeBufSize is the default size of the output buffer of the stream encoder.
+const encodeBufSize = 1024
+
+// NewEncoderSize is like NewEncoder but the encoder buffers its output in bufSize bytes.
+// A larger buffer reduces the calls of w.Write, and a smaller one saves memory.
+// bufSize is raised to the size of a block, 4 runes of enc, if it is smaller.
+func NewEncoderSize(enc *Encoding, w io.Writer, bufSize int) io.WriteCloser {
+	if bufSize < 4*enc.maxSize {
+		bufSize = 4 * enc.maxSize
+	}
+	if enc.checksum != nil {
+		e := NewEncoderSize(enc.withoutChecksum(), w, bufSize).(Encoder)
+		return &checksumEncoder{e: e, sum: enc.checksum}
+	}
+	return &encoder{enc: enc, w: w, out: make([]byte, bufSize)}
+}
+
+// NewBlockEncoder returns a new base64 stream encoder
+// whose every call of w.Write is a complete set of 4-rune blocks,
+// e.g. for a framing layer multiplexing several encoded streams over one writer.
+// Each Write buffers the bytes until they make complete 3-byte blocks,
+// and writes the output of all of them in a single call of w.Write,
+// so a rune or a block is never split across the calls.
+// The output buffer grows to hold the output of the largest Write.
+//
+// Close writes the final block in a single call of w.Write, padded unless enc has no padding;
+// it writes nothing if no bytes are pending. Flush keeps the pending bytes,
+// as they don't make a complete block.
+// If enc has a checksum, Close may write the block completed by the checksum
+// and the final block in separate calls.
+func NewBlockEncoder(enc *Encoding, w io.Writer) io.WriteCloser {
+	if enc.checksum != nil {
+		e := NewBlockEncoder(enc.withoutChecksum(), w).(Encoder)
+		return &checksumEncoder{e: e, sum: enc.checksum}
+	}
+	return &encoder{enc: enc, w: w, out: make([]byte, encodeBufSize), block: true}
+}
+
+// ErrShortBuffer is returned by Decode and EncodeSafe when dst is too short to hold the result.
+var ErrShortBuffer = errors.New("base64dq: short buffer")
+
+// CorruptInputError is the byte offset of a corruption in the input.
+// The errors returned by decoding functions can be converted to CorruptInputError by errors.As.
+type CorruptInputError int64
+
+// Error implements the error interface.
+func (e CorruptInputError) Error() string {
+	return "illegal base64dq data at input byte " + strconv.FormatInt(int64(e), 10)
+}
+
+// The causes of the corruption in the input.
+// The errors returned by decoding functions wrap one of them.
+var (
+	ErrInvalidRune     = errors.New("invalid rune")           // a rune that the decoder doesn't accept
+	ErrInvalidUTF8     = errors.New("invalid UTF-8")          // a malformed or truncated UTF-8 sequence, such as mojibake
+	ErrBadPadding      = errors.New("misplaced padding")      // padding where none is required, e.g. after a complete block
+	ErrTruncated       = errors.New("truncated input")        // the input ends in the middle of a block
+	ErrTrailingBits    = errors.New("non-zero trailing bits") // reported only by strict encodings
+	ErrTrailingGarbage = errors.New("trailing garbage")       // data after the padded final block
+)
+
+// DecodeError is returned when the input is not a valid base64dq.
+// It wraps the cause of the corruption, such as ErrInvalidRune,
+// and can be converted to CorruptInputError by errors.As.
+type DecodeError struct {
+	ByteOffset int   // byte offset of the corruption
+	RuneIndex  int   // rune index of the corruption
+	Rune       rune  // rune at ByteOffset, or -1 at the end of the input
+	Err        error // cause of the corruption
+}
+
+// newDecodeError returns a DecodeError at offset in src.
+func newDecodeError[T string | []byte](src T, offset int, err error) error {
+	e := &DecodeError{
+		ByteOffset: offset,
+		RuneIndex:  runeCount(src[:offset]),
+		Rune:       -1,
+		Err:        err,
+	}
+	if offset < len(src) {
+		end := offset + utf8.UTFMax
+		if end > len(src) {
+			end = len(src)
+		}
+		e.Rune, _ = utf8.DecodeRuneInString(string(src[offset:end]))
+	}
+	return e
+}
+
+// malformed reports whether p starts with a malformed UTF-8 sequence.
+// The valid but incomplete sequences are not malformed.
+func malformed[T string | []byte](p T) bool {
+	var buf [utf8.UTFMax]byte
+	q := buf[:copy(buf[:], p)]
+	r, size := utf8.DecodeRune(q)
+	return r == utf8.RuneError && size == 1 && utf8.FullRune(q)
+}
+
+// invalidUTF8 is malformed for p that extends to the end of the input,
+// where the incomplete sequences are also invalid.
+func invalidUTF8[T string | []byte](p T) bool {
+	var buf [utf8.UTFMax]byte
+	q := buf[:copy(buf[:], p)]
+	r, size := utf8.DecodeRune(q)
+	return r == utf8.RuneError && size == 1
+}
+
+// runeStart returns the start of the rune in progress that ends at src[i-1].
+func runeStart[T string | []byte](src T, i int) int {
+	start := i - 1
+	for start > 0 && !isRuneStart(src[start]) {
+		start--
+	}
+	return start
+}
+
+// invalidRuneError returns the error for src[i] that the DFA in the state prev doesn't accept.
+// If the rune containing src[i] is malformed, it reports ErrInvalidUTF8 at the rune.
+// Otherwise, it reports ErrInvalidRune at lastRune.
+func invalidRuneError[T string | []byte](src T, i int, prev *node, lastRune int) error {
+	start := i
+	if prev.v == midNode {
+		// the rune in progress starts before i.
+		start = runeStart(src, i)
+	}
+	if invalidUTF8(src[start:]) {
+		return newDecodeError(src, start, ErrInvalidUTF8)
+	}
+	return newDecodeError(src, lastRune, ErrInvalidRune)
+}
+
+// runeCount is same as utf8.RuneCount except that
+// each of incomplete sequences are counted as one rune.
+func runeCount[T string | []byte](s T) int {
+	n := len(s)
+	i := 0
+	// Count the continuation bytes 0b10xxxxxx, eight bytes at a time.
+	for ; i+8 <= len(s); i += 8 {
+		x := uint64(s[i]) | uint64(s[i+1])<<8 | uint64(s[i+2])<<16 | uint64(s[i+3])<<24 |
+			uint64(s[i+4])<<32 | uint64(s[i+5])<<40 | uint64(s[i+6])<<48 | uint64(s[i+7])<<56
+		n -= bits.OnesCount64(x &^ (x << 1) & 0x8080808080808080)
+	}
+	for ; i < len(s); i++ {
+		if !isRuneStart(s[i]) {
+			n--
+		}
+	}
+	return n
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	if e.Rune < 0 {
+		return fmt.Sprintf("illegal base64dq data: end of input at position %d: %v", e.RuneIndex, e.Err)
+	}
+	return fmt.Sprintf("illegal base64dq data: rune %q at position %d: %v", e.Rune, e.RuneIndex, e.Err)
+}
+
+// Unwrap returns the cause of the corruption.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// As converts e to CorruptInputError.
+func (e *DecodeError) As(target any) bool {
+	if p, ok := target.(*CorruptInputError); ok {
+		*p = CorruptInputError(e.ByteOffset)
+		return true
+	}
+	return false
+}
+
+// Decode decodes src using the encoding enc. It writes at most
+// DecodedLen(len(src)) bytes to dst and returns the number of bytes
+// written. If src contains invalid base64dq data, it will return
+// a *DecodeError. If dst is too short to hold the decoded data,
+// it will return ErrShortBuffer.
+//
+// A block made only of padding, e.g. "・・" at the start of src or after
+// a complete block, is reported as ErrBadPadding at the end of the last
+// alphabet rune before it. Padding after the padded final block is
+// ErrTrailingGarbage. The Decoder returned by NewDecoder reports the same
+// offsets.
+func (enc *Encoding) Decode(dst, src []byte) (int, error) {
+	return decode(enc, dst, src, true, nil)
+}
+
+// DecodeConsumed is like Decode, but decodes only the longest prefix of src
+// that is valid base64dq data, and also returns the number of bytes of src consumed.
+// Decoding stops before the first rune that can't continue the data,
+// and backs off to the end of the last complete or padded block if needed,
+// so the caller can continue parsing src[nSrc:].
+// Stopping early is not an error; err reports only the errors
+// in the consumed data, such as ErrShortBuffer or ErrTrailingBits.
+//
+// If the encoding composes kana or ignores invalid runes,
+// src is decoded as a whole like Decode.
+func (enc *Encoding) DecodeConsumed(dst, src []byte) (nDst, nSrc int, err error) {
+	if enc.compose || enc.ignoreInvalid {
+		// the offsets of the errors don't match src.
+		nDst, err = decode(enc, dst, src, true, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		return nDst, len(src), nil
+	}
+	return decodePrefix(enc, dst, src)
+}
+
+// decodePrefix decodes the longest prefix of src that is valid base64dq data.
+func decodePrefix(enc *Encoding, dst, src []byte) (nDst, nSrc int, err error) {
+	end := len(src)
+	for {
+		nDst, err = decode(enc, dst, src[:end], true, nil)
+		if err == nil {
+			return nDst, end, nil
+		}
+		var e *DecodeError
+		if !errors.As(err, &e) || e.Err == ErrTrailingBits {
+			return 0, 0, err
+		}
+		if e.ByteOffset < end {
+			end = e.ByteOffset
+		} else {
+			// the last rune is incomplete, drop it.
+			_, size := utf8.DecodeLastRune(src[:end])
+			end -= size
+		}
+	}
+}
+
+// DecodePartial is like Decode, but on a corruption of src it also returns
+// the bytes decoded from the valid data before the corruption,
+// so recovery tools can salvage the leading valid portion of damaged data.
+// The salvaged data ends at the last complete or padded block before the corruption,
+// or at the partial final block if the encoding has no padding.
+// The error is the same as Decode; it can be converted to CorruptInputError by errors.As.
+// If the encoding has a checksum, the salvaged data is not verified and includes no checksum.
+//
+// If dst is too short to hold the decoded data, it returns 0 and ErrShortBuffer.
+func (enc *Encoding) DecodePartial(dst, src []byte) (n int, err error) {
+	n, err = decode(enc, dst, src, true, nil)
+	var e *DecodeError
+	if err == nil || !errors.As(err, &e) {
+		return n, err
+	}
+
+	// the offsets of the errors are relative to the composed input without the invalid runes.
+	if enc.compose && hasCombiningMark(src) {
+		src = composeKana(append([]byte(nil), src...), nil)
+	}
+	if enc.ignoreInvalid {
+		src = enc.dropInvalid(append([]byte(nil), src...), nil)
+	}
+	prefix := enc
+	if enc.checksum != nil {
+		prefix = enc.withoutChecksum()
+	}
+	n, _, perr := decodePrefix(prefix, dst, src[:e.ByteOffset])
+	if perr != nil {
+		return 0, err
+	}
+	return n, err
+}
+
+// DecodeN decodes exactly nBytes bytes from the beginning of src into dst,
+// and returns the number of bytes of src consumed,
+// so the caller can continue parsing src[nSrc:].
+// Decoding stops right after the rune that completes the nBytes bytes,
+// or after its padding if nBytes is not a multiple of 3 and the encoding is padded;
+// the ignored runes after it are not consumed.
+// If src ends before nBytes bytes, it returns a *DecodeError wrapping ErrTruncated.
+// If the encoding has a checksum, the checksum follows the nBytes bytes,
+// and dst must have room for it.
+func (enc *Encoding) DecodeN(dst, src []byte, nBytes int) (nSrc int, err error) {
+	if nBytes < 0 {
+		panic("negative length")
+	}
+	if enc.checksum != nil {
+		nBytes++
+	}
+	if nBytes == 0 {
+		return 0, nil
+	}
 
-	// Leading fringe.
-	if e.nbuf > 0 {
-		var i int
-		for i = 0; i < len(p) && e.nbuf < 3; i++ {
-			e.buf[e.nbuf] = p[i]
-			e.nbuf++
-		}
-		n += i
-		p = p[i:]
-		if e.nbuf < 3 {
-			return
-		}
-		size := e.enc.Encode(e.out[:], e.buf[:])
-		if _, e.err = e.w.Write(e.out[:size]); e.err != nil {
-			return n, e.err
+	// the number of the alphabet runes and the padding runes to consume.
+	runes := nBytes / 3 * 4
+	pads := 0
+	if rem := nBytes % 3; rem > 0 {
+		runes += rem + 1
+		if enc.padChar != NoPadding {
+			pads = 3 - rem
+			if enc.singlePad {
+				pads = 1
+			}
 		}
-		e.nbuf = 0
 	}
 
-	// Large interior chunks.
-	for len(p) >= 3 {
-		nn := len(e.out) / e.enc.maxSize / 4 * 3
-		if nn > len(p) {
-			nn = len(p)
-			nn -= nn % 3
+	m := enc.decodeMap()
+	i := bomLen(enc, src)
+	for i < len(src) && runes+pads > 0 {
+		r, size := utf8.DecodeRune(src[i:])
+		i += size
+		v, ok := m.search(r)
+		switch {
+		case r == utf8.RuneError && size == 1, !ok:
+			if enc.ignoreInvalid || enc.compose && (r == voicedMark || r == semiVoicedMark) {
+				// the combining marks belong to the previous rune.
+				continue
+			}
+			// let decode report the invalid rune.
+			runes, pads = 0, 0
+		case v == rootNode:
+		case (v == paddingNode) != (runes == 0):
+			// let decode report the misplaced or the missing padding.
+			runes, pads = 0, 0
+		case runes > 0:
+			runes--
+		default:
+			pads--
 		}
-		size := e.enc.Encode(e.out[:], p[:nn])
-		if _, e.err = e.w.Write(e.out[:size]); e.err != nil {
-			return n, e.err
+	}
+	if enc.compose {
+		// the combining marks belong to the last rune.
+		for i < len(src) {
+			r, size := utf8.DecodeRune(src[i:])
+			if r != voicedMark && r != semiVoicedMark {
+				break
+			}
+			i += size
 		}
-		n += nn
-		p = p[nn:]
 	}
 
-	// Trailing fringe.
-	copy(e.buf[:], p)
-	e.nbuf = len(p)
-	n += len(p)
-	return n, nil
+	n, err := decode(enc, dst, src[:i], true, nil)
+	if err != nil {
+		return 0, err
+	}
+	if enc.checksum != nil {
+		n++
+	}
+	if n < nBytes {
+		return 0, newDecodeError(src, len(src), ErrTruncated)
+	}
+	return i, nil
 }
 
-// Close flushes any pending output from the encoder.
-// It is an error to call Write after calling Close.
-func (e *encoder) Close() error {
-	// If there's anything left in the buffer, flush it out
-	if e.err == nil && e.nbuf > 0 {
-		size := e.enc.Encode(e.out[:], e.buf[:e.nbuf])
-		_, e.err = e.w.Write(e.out[:size])
-		e.nbuf = 0
+// Validate reports whether s is a valid base64dq data.
+// It returns the same error as Decode without writing the decoded data.
+func (enc *Encoding) Validate(s string) error {
+	_, err := enc.DecodedCount(s)
+	return err
+}
+
+// DecodedCount returns the number of bytes that Decode writes for s,
+// without allocating the buffer for them.
+// It returns the same error as Decode if s is not valid.
+func (enc *Encoding) DecodedCount(s string) (int, error) {
+	if enc.checksum != nil {
+		// the checksum needs the decoded data.
+		data, err := enc.DecodeString(s)
+		return len(data), err
 	}
-	return e.err
+	return decode(enc, nil, s, false, nil)
 }
 
-// NewEncoder returns a new base64 stream encoder.
-func NewEncoder(enc *Encoding, w io.Writer) io.WriteCloser {
-	return &encoder{enc: enc, w: w}
+// chunkWriter writes the decoded data to w whenever dst of decode is full,
+// so that dst can be a small buffer.
+type chunkWriter struct {
+	w   io.Writer
+	n   int // number of bytes written to w
+	err error
 }
 
-// CorruptInputError is returned when the input is not a valid base64dq.
-type CorruptInputError int64
+// flush writes dst[:*k] to w and resets *k.
+// It reports false with f.err set if f is nil or the write fails.
+func (f *chunkWriter) flush(dst []byte, k *int) bool {
+	if f == nil {
+		return false
+	}
+	nw, err := f.w.Write(dst[:*k])
+	f.n += nw
+	if err == nil && nw != *k {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		f.err = err
+		return false
+	}
+	*k = 0
+	return true
+}
 
-// Error implements the error interface.
-func (e CorruptInputError) Error() string {
-	return "illegal base64dq data at input byte " + strconv.FormatInt(int64(e), 10)
+// shortBuffer returns the error of decode when dst is full and f can't flush it.
+func (f *chunkWriter) shortBuffer() error {
+	if f == nil {
+		return ErrShortBuffer
+	}
+	return f.err
 }
 
-func (enc *Encoding) Decode(dst, src []byte) (int, error) {
+// decode decodes src into dst.
+// If write is false, it only validates src and dst is never touched.
+// If dst is full, it flushes dst to f and continues from the start of dst,
+// or returns ErrShortBuffer if f is nil.
+// It returns the number of bytes in dst that are not flushed yet.
+func decode[T string | []byte](enc *Encoding, dst []byte, src T, write bool, f *chunkWriter) (int, error) {
 	// Decode quantum using the base64 alphabet
 	var dbuf [4]byte
 
-	enc.buildOnce()
-	n := enc.root
+	if enc.compose && hasCombiningMark(src) {
+		src = T(composeKana(append([]byte(nil), src...), nil))
+	}
+	if enc.ignoreInvalid {
+		src = T(enc.dropInvalid(append([]byte(nil), src...), nil))
+	}
+	if enc.constantTime {
+		return decodeConstantTime(enc, dst, []byte(src), write)
+	}
+
+	root := enc.buildOnce().root
+	n := root
+	i := bomLen(enc, src)
 	padCount := 0
-	lastBlock := 0 // position of last block boundary
-	lastRune := 0  // position of last rune that contributed to the output
-	i := 0
+	lastBlock := i // position of last block boundary
+	lastRune := i  // position of last rune that contributed to the output
 	j := 0
 	k := 0
 
 LOOP:
 	for ; i < len(src); i++ {
 		b := src[i]
-		n = n.children[b]
-		if n == nil {
-			return 0, CorruptInputError(lastRune)
+		next := n.next(b)
+		if next == nil {
+			return 0, invalidRuneError(src, i, n, lastRune)
 		}
+		n = next
 
 		v := n.v
 		if v < 0 {
@@ -378,10 +1698,16 @@ LOOP:
 			switch j % 4 {
 			case 0, 1:
 				// incorrect padding
-				return 0, CorruptInputError(lastRune)
+				return 0, newDecodeError(src, lastRune, ErrBadPadding)
 			}
 			padCount++
 			v = 0
+			if enc.singlePad && j%4 == 2 {
+				// the single padding completes the block of two alphabet runes.
+				dbuf[2] = 0
+				j++
+				padCount++
+			}
 		}
 
 		dbuf[j%4] = byte(v)
@@ -392,29 +1718,54 @@ LOOP:
 			val := uint(dbuf[0])<<18 | uint(dbuf[1])<<12 | uint(dbuf[2])<<6 | uint(dbuf[3])
 			switch padCount {
 			case 0:
-				dst[k+0] = byte(val >> 16)
-				dst[k+1] = byte(val >> 8)
-				dst[k+2] = byte(val >> 0)
+				if write {
+					if len(dst)-k < 3 && !f.flush(dst, &k) {
+						return 0, f.shortBuffer()
+					}
+					dst[k+0] = byte(val >> 16)
+					dst[k+1] = byte(val >> 8)
+					dst[k+2] = byte(val >> 0)
+				}
 				k += 3
 			case 1:
-				dst[k+0] = byte(val >> 16)
-				dst[k+1] = byte(val >> 8)
+				if write {
+					if len(dst)-k < 2 && !f.flush(dst, &k) {
+						return 0, f.shortBuffer()
+					}
+					dst[k+0] = byte(val >> 16)
+					dst[k+1] = byte(val >> 8)
+				}
 				if enc.strict && (val&0xFF) != 0 {
-					return 0, CorruptInputError(lastRune)
+					return 0, newDecodeError(src, lastRune, ErrTrailingBits)
 				}
 				k += 2
+				if enc.concat {
+					// start the next stream.
+					n, padCount, lastRune = root, 0, i+1
+					continue
+				}
 				i += 1
 				break LOOP
 			case 2:
-				dst[k+0] = byte(val >> 16)
+				if write {
+					if len(dst)-k < 1 && !f.flush(dst, &k) {
+						return 0, f.shortBuffer()
+					}
+					dst[k+0] = byte(val >> 16)
+				}
 				if enc.strict && (val&0xFFFF) != 0 {
-					return 0, CorruptInputError(lastRune)
+					return 0, newDecodeError(src, lastRune, ErrTrailingBits)
 				}
 				k += 1
+				if enc.concat {
+					// start the next stream.
+					n, padCount, lastRune = root, 0, i+1
+					continue
+				}
 				i += 1
 				break LOOP
 			case 3, 4:
-				return 0, CorruptInputError(lastRune)
+				return 0, newDecodeError(src, lastRune, ErrBadPadding)
 			}
 		}
 		if n.v < 64 {
@@ -422,17 +1773,17 @@ LOOP:
 		}
 	}
 	if n.v < 0 && n.v != rootNode {
-		// invalid rune
-		return 0, CorruptInputError(i)
+		// the input ends in the middle of a rune.
+		return 0, newDecodeError(src, runeStart(src, i), ErrInvalidUTF8)
 	}
 
 	// handle remaining bytes and padding
 	if j%4 != 0 {
 		if enc.padChar != NoPadding {
 			if padCount == 0 {
-				return 0, CorruptInputError(lastBlock)
+				return 0, newDecodeError(src, lastBlock, ErrTruncated)
 			}
-			return 0, CorruptInputError(i)
+			return 0, newDecodeError(src, i, ErrTruncated)
 		}
 
 		// Convert 4x 6bit source bytes into 3 bytes
@@ -442,29 +1793,52 @@ LOOP:
 		val := uint(dbuf[0])<<18 | uint(dbuf[1])<<12 | uint(dbuf[2])<<6 | uint(dbuf[3])
 		switch j % 4 {
 		case 0, 1:
-			return 0, CorruptInputError(i)
+			return 0, newDecodeError(src, i, ErrTruncated)
 		case 2:
-			dst[k+0] = byte(val >> 16)
+			if write {
+				if len(dst)-k < 1 && !f.flush(dst, &k) {
+					return 0, f.shortBuffer()
+				}
+				dst[k+0] = byte(val >> 16)
+			}
 			if enc.strict && (val&0xFFFF) != 0 {
-				return 0, CorruptInputError(lastRune)
+				return 0, newDecodeError(src, lastRune, ErrTrailingBits)
 			}
 			k += 1
 		case 3:
-			dst[k+0] = byte(val >> 16)
-			dst[k+1] = byte(val >> 8)
+			if write {
+				if len(dst)-k < 2 && !f.flush(dst, &k) {
+					return 0, f.shortBuffer()
+				}
+				dst[k+0] = byte(val >> 16)
+				dst[k+1] = byte(val >> 8)
+			}
 			if enc.strict && (val&0xFF) != 0 {
-				return 0, CorruptInputError(lastRune)
+				return 0, newDecodeError(src, lastRune, ErrTrailingBits)
 			}
 			k += 2
 		}
 	}
+	n = enc.dfa.trail
+	start := i // position of the rune being checked
 	for ; i < len(src); i++ {
-		if src[i] != '\n' && src[i] != '\r' {
+		n = n.next(src[i])
+		if n == nil {
 			// trailing garbage
-			return 0, CorruptInputError(i)
+			return 0, newDecodeError(src, start, ErrTrailingGarbage)
 		}
+		if n.v == rootNode {
+			start = i + 1
+		}
+	}
+	if n.v != rootNode {
+		// trailing garbage
+		return 0, newDecodeError(src, start, ErrTrailingGarbage)
 	}
 
+	if write && enc.checksum != nil {
+		return enc.verifyChecksum(dst[:k])
+	}
 	return k, nil
 }
 
@@ -476,14 +1850,21 @@ type decoder struct {
 	readErr error // error from r.Read
 
 	// buffer for input
-	n         int64      // total bytes consumed
-	padCount  int        // number of padding characters seen
-	lastBlock int64      // position of last block boundary
-	lastRune  int64      // position of last rune that contributed to the output
-	buf       [4096]byte // source bytes waiting to be decoded
-	pos       int        // current position in buf
-	nbuf      int        // number of bytes in buf
-	expectEOF bool       // whether a base64dq stream expects to end soon
+	base      int64             // position of buf[0] in the input
+	rawBase   int64             // position of buf[0] in the raw input from r
+	composed  gaps              // bytes removed from buf by composeKana
+	dropped   gaps              // bytes removed from buf by dropInvalid
+	runeBase  int               // number of runes before buf[0]
+	padCount  int               // number of padding characters seen
+	lastBlock position          // position of last block boundary
+	lastRune  position          // position of last rune that contributed to the output
+	buf       []byte            // source bytes waiting to be decoded
+	pos       int               // current position in buf
+	nbuf      int               // number of bytes in buf
+	nhold     int               // number of bytes after nbuf held back until the next refill
+	expectEOF bool              // whether a base64dq stream expects to end soon
+	look      [utf8.UTFMax]byte // bytes read by completeHead after the buffer
+	nlook     int               // number of bytes in look
 
 	// buffer for output
 	dbuf  [4]byte // Decode quantum using the base64 alphabet
@@ -492,6 +1873,161 @@ type decoder struct {
 	nout  int     // number of bytes in out
 }
 
+// gap is a place in a buffer where some bytes are removed.
+type gap struct {
+	pos int // position in the buffer after the removal
+	n   int // number of bytes removed at or before pos in total
+}
+
+// gaps records the bytes removed from a buffer, in order of position.
+type gaps []gap
+
+// add records that n bytes are removed at pos. It does nothing if g is nil.
+func (g *gaps) add(pos, n int) {
+	if g == nil {
+		return
+	}
+	if k := len(*g); k > 0 {
+		last := &(*g)[k-1]
+		if last.pos == pos {
+			last.n += n
+			return
+		}
+		n += last.n
+	}
+	*g = append(*g, gap{pos: pos, n: n})
+}
+
+// raw returns the position before the removal corresponding to pos.
+func (g gaps) raw(pos int) int {
+	n := 0
+	for _, gap := range g {
+		if gap.pos > pos {
+			break
+		}
+		n = gap.n
+	}
+	return pos + n
+}
+
+// mark is a position in the input of a decoder.
+type mark struct {
+	offset int64             // byte offset
+	index  int               // rune index
+	head   [utf8.UTFMax]byte // leading bytes of the rune at the position
+	nhead  int               // number of bytes in head
+}
+
+// feed records b that is consumed after the position.
+func (m *mark) feed(b byte) {
+	if m.nhead < len(m.head) {
+		m.head[m.nhead] = b
+		m.nhead++
+	}
+}
+
+// error returns a DecodeError at the position.
+func (m mark) error(err error) error {
+	e := &DecodeError{
+		ByteOffset: int(m.offset),
+		RuneIndex:  m.index,
+		Rune:       -1,
+		Err:        err,
+	}
+	if m.nhead > 0 {
+		e.Rune, _ = utf8.DecodeRune(m.head[:m.nhead])
+	}
+	return e
+}
+
+// position is a position in the input of a decoder.
+// The decoder updates only the offset while decoding,
+// and computes the mark at the position on error.
+type position struct {
+	offset int64 // byte offset
+	saved  mark  // mark at offset, saved when the buffer containing it is discarded
+}
+
+// markAt returns the mark at buf[pos], which is the index-th rune of the input,
+// with the leading bytes of the rune in the buffer.
+func (d *decoder) markAt(pos, index int) mark {
+	m := mark{offset: d.base + int64(pos), index: index}
+	for _, b := range d.buf[pos : d.nbuf+d.nhold] {
+		if m.nhead > 0 && utf8.FullRune(m.head[:m.nhead]) {
+			break
+		}
+		m.feed(b)
+	}
+	return m
+}
+
+// markIn returns the mark at buf[pos], reading the rest of the rune after the buffer if needed.
+// The bytes before pos are valid UTF-8, as the decoder has accepted them.
+func (d *decoder) markIn(pos int) mark {
+	m := d.markAt(pos, d.runeBase+runeCount(d.buf[:pos]))
+	d.completeHead(&m)
+	return m
+}
+
+// mark returns the mark at p.
+func (d *decoder) mark(p position) mark {
+	if p.offset < d.base {
+		return p.saved
+	}
+	return d.markIn(int(p.offset - d.base))
+}
+
+// save saves the mark at p before refill discards the buffer containing it.
+// The buffer contains n runes, all of them complete.
+func (d *decoder) save(p *position, n int) {
+	if p.offset >= d.base && p.offset < d.base+int64(d.nbuf) {
+		pos := int(p.offset - d.base)
+		p.saved = d.markAt(pos, d.runeBase+n-runeCount(d.buf[pos:d.nbuf]))
+	}
+}
+
+// completeHead reads the rest of the rune at m after the buffer,
+// so that the error can report the whole rune.
+// The bytes read from the underlying reader are kept in d.look,
+// so that completeHead can be called for another mark.
+func (d *decoder) completeHead(m *mark) {
+	look := d.look[:d.nlook]
+	for m.nhead < len(m.head) && !utf8.FullRune(m.head[:m.nhead]) {
+		if len(look) > 0 {
+			m.feed(look[0])
+			look = look[1:]
+			continue
+		}
+		if d.readErr != nil || d.nlook == len(d.look) || d.paused() {
+			break
+		}
+		var nn int
+		nn, d.readErr = d.r.Read(d.look[d.nlook : d.nlook+1])
+		if nn > 0 {
+			m.feed(d.look[d.nlook])
+			d.nlook++
+		}
+	}
+}
+
+// invalidRune returns the error for buf[pos] that the DFA in d.state doesn't accept.
+// If the rune containing buf[pos] is malformed, it reports ErrInvalidUTF8 at the rune.
+// Otherwise, it reports ErrInvalidRune at d.lastRune.
+func (d *decoder) invalidRune() error {
+	start := d.pos
+	if d.state.v == midNode {
+		// buf[pos] continues or interrupts the rune in progress.
+		start = runeStart(d.buf, d.pos)
+	}
+	d.state = nil
+
+	m := d.markIn(start)
+	if malformed(m.head[:m.nhead]) {
+		return m.error(ErrInvalidUTF8)
+	}
+	return d.mark(d.lastRune).error(ErrInvalidRune)
+}
+
 func (d *decoder) Read(p []byte) (n int, err error) {
 	// Use leftover decoded output from last read.
 	if d.nout > 0 {
@@ -505,129 +2041,243 @@ func (d *decoder) Read(p []byte) (n int, err error) {
 		return 0, d.err
 	}
 
-	// Refill buffer.
-	if d.pos >= d.nbuf {
-		d.pos = 0
-		d.nbuf = 0
-		nn := len(p) / 3 * 4 * d.enc.maxSize
-		if nn < 4*d.enc.maxSize {
-			nn = 4 * d.enc.maxSize
-		}
-		if nn > len(d.buf) {
-			nn = len(d.buf)
-		}
-		for d.nbuf < 4*d.enc.maxSize && d.readErr == nil {
-			nn, d.readErr = d.r.Read(d.buf[d.nbuf:nn])
-			d.nbuf += nn
+	// Decode as many blocks as fit in p from the buffer.
+	// The buffer is refilled only until some output is available,
+	// so that Read doesn't wait for more input while it has data to return.
+	for {
+		d.refill(len(p))
+		if d.expectEOF {
+			return n, d.readTrail()
 		}
-	}
 
-	if d.expectEOF {
-		for ; d.pos < d.nbuf; d.pos, d.n = d.pos+1, d.n+1 {
-			if d.buf[d.pos] != '\n' && d.buf[d.pos] != '\r' {
-				// trailing garbage
-				d.err = CorruptInputError(d.n)
-				return 0, d.err
+		for ; d.pos < d.nbuf && len(p) > 0; d.pos++ {
+			next := d.state.next(d.buf[d.pos])
+			if next == nil {
+				d.err = d.invalidRune()
+				return n, d.err
 			}
-		}
-		d.err = d.readErr
-		return 0, d.err
-	}
-
-	for ; d.pos < d.nbuf && len(p) > 0; d.pos, d.n = d.pos+1, d.n+1 {
-		b := d.buf[d.pos]
-		d.state = d.state.children[b]
-		if d.state == nil {
-			d.err = CorruptInputError(d.lastRune)
-			return n, d.err
-		}
+			d.state = next
 
-		v := d.state.v
-		if v < 0 {
-			continue
-		}
-		if v == 64 {
-			switch d.ndbuf {
-			case 0, 1:
-				// incorrect padding
-				d.err = CorruptInputError(d.lastRune)
-				return n, d.err
+			v := d.state.v
+			if v < 0 {
+				continue
+			}
+			if v == 64 {
+				switch d.ndbuf {
+				case 0, 1:
+					// incorrect padding
+					d.err = d.mark(d.lastRune).error(ErrBadPadding)
+					return n, d.err
+				}
+				d.padCount++
+				v = 0
+				if d.enc.singlePad && d.ndbuf == 2 {
+					// the single padding completes the block of two alphabet runes.
+					d.dbuf[2] = 0
+					d.ndbuf++
+					d.padCount++
+				}
 			}
-			d.padCount++
-			v = 0
-		}
 
-		d.dbuf[d.ndbuf] = byte(v)
-		d.ndbuf++
-		if d.ndbuf == 4 {
-			d.ndbuf = 0
-			d.lastBlock = d.n + 1
-			// Convert 4x 6bit source bytes into 3 bytes
-			val := uint(d.dbuf[0])<<18 | uint(d.dbuf[1])<<12 | uint(d.dbuf[2])<<6 | uint(d.dbuf[3])
-			if d.padCount == 0 && len(p) >= 3 {
-				p[0] = byte(val >> 16)
-				p[1] = byte(val >> 8)
-				p[2] = byte(val >> 0)
-				p = p[3:]
-				n += 3
-			} else {
-				switch d.padCount {
-				case 0:
-					d.out[0] = byte(val >> 16)
-					d.out[1] = byte(val >> 8)
-					d.out[2] = byte(val >> 0)
-					d.nout = 3
-				case 1:
-					d.out[0] = byte(val >> 16)
-					d.out[1] = byte(val >> 8)
-					if d.enc.strict && (val&0xFF) != 0 {
-						d.err = CorruptInputError(d.lastRune)
+			d.dbuf[d.ndbuf] = byte(v)
+			d.ndbuf++
+			if d.ndbuf == 4 {
+				d.ndbuf = 0
+				d.lastBlock.offset = d.base + int64(d.pos) + 1
+				// Convert 4x 6bit source bytes into 3 bytes
+				val := uint(d.dbuf[0])<<18 | uint(d.dbuf[1])<<12 | uint(d.dbuf[2])<<6 | uint(d.dbuf[3])
+				if d.padCount == 0 && len(p) >= 3 {
+					p[0] = byte(val >> 16)
+					p[1] = byte(val >> 8)
+					p[2] = byte(val >> 0)
+					p = p[3:]
+					n += 3
+				} else {
+					switch d.padCount {
+					case 0:
+						d.out[0] = byte(val >> 16)
+						d.out[1] = byte(val >> 8)
+						d.out[2] = byte(val >> 0)
+						d.nout = 3
+					case 1:
+						d.out[0] = byte(val >> 16)
+						d.out[1] = byte(val >> 8)
+						if d.enc.strict && (val&0xFF) != 0 {
+							d.err = d.mark(d.lastRune).error(ErrTrailingBits)
+							return n, d.err
+						}
+						d.nout = 2
+						d.endStream()
+					case 2:
+						d.out[0] = byte(val >> 16)
+						if d.enc.strict && (val&0xFFFF) != 0 {
+							d.err = d.mark(d.lastRune).error(ErrTrailingBits)
+							return n, d.err
+						}
+						d.nout = 1
+						d.endStream()
+					case 3, 4:
+						d.err = d.mark(d.lastRune).error(ErrBadPadding)
 						return n, d.err
 					}
-					d.nout = 2
-					d.expectEOF = true
-				case 2:
-					d.out[0] = byte(val >> 16)
-					if d.enc.strict && (val&0xFFFF) != 0 {
-						d.err = CorruptInputError(d.lastRune)
-						return n, d.err
+					nn := copy(p, d.out[:d.nout])
+					p = p[nn:]
+					d.nout -= nn
+					copy(d.out[:], d.out[nn:])
+					n += nn
+					if d.expectEOF {
+						d.pos++
+						d.state = d.enc.dfa.trail
+						d.lastRune.offset = d.base + int64(d.pos)
+						return n, nil
 					}
-					d.nout = 1
-					d.expectEOF = true
-				case 3, 4:
-					d.err = CorruptInputError(d.lastRune)
-					return n, d.err
-				}
-				nn := copy(p, d.out[:d.nout])
-				p = p[nn:]
-				d.nout -= nn
-				copy(d.out[:], d.out[nn:])
-				n += nn
-				if d.expectEOF {
-					d.pos++
-					d.n++
-					break
 				}
 			}
+			if d.state.v < 64 {
+				d.lastRune.offset = d.base + int64(d.pos) + 1
+			}
+		}
+		if d.readErr != nil && d.pos >= d.nbuf {
+			return d.finish(p, n)
+		}
+		if d.pos >= d.nbuf && d.paused() {
+			// the input has no more data for now.
+			return n, nil
+		}
+		if len(p) == 0 || n > 0 {
+			// the rest of the input is decoded by the next Read.
+			return n, nil
+		}
+	}
+}
+
+// pauser is implemented by the input of the decoder that can run out of data
+// before its end, such as the input of the validator.
+type pauser interface {
+	// paused reports whether the input has no data to read for now.
+	paused() bool
+}
+
+// paused reports whether the input of d is paused.
+// The decoder doesn't read a paused input, and Read returns the data decoded so far.
+func (d *decoder) paused() bool {
+	p, ok := d.r.(pauser)
+	return ok && p.paused()
+}
+
+// refill refills the buffer for decoding np bytes.
+// The skipped runes may empty the buffer, so it refills the buffer again until some bytes remain.
+func (d *decoder) refill(np int) {
+	for d.pos >= d.nbuf {
+		// Save the marks in the buffer, and move the bytes held back by the last refill to the front.
+		// The incomplete rune at the end is held back, so the buffer consists of complete runes.
+		n := runeCount(d.buf[:d.nbuf])
+		d.save(&d.lastBlock, n)
+		d.save(&d.lastRune, n)
+		d.runeBase += n
+		d.base += int64(d.nbuf)
+		d.rawBase += int64(d.raw(d.nbuf))
+		d.composed, d.dropped = d.composed[:0], d.dropped[:0]
+		nhold := d.nhold
+		copy(d.buf, d.buf[d.nbuf:d.nbuf+nhold])
+		d.pos = 0
+		d.nbuf = nhold
+		d.nhold = 0
+		size := np / 3 * 4 * d.enc.maxSize
+		if size < 4*d.enc.maxSize {
+			size = 4 * d.enc.maxSize
+		}
+		size += nhold
+		if size > len(d.buf) {
+			size = len(d.buf)
+		}
+		for d.nbuf < nhold+4*d.enc.maxSize && d.readErr == nil && !d.paused() {
+			var nn int
+			nn, d.readErr = d.r.Read(d.buf[d.nbuf:size])
+			d.nbuf += nn
+		}
+		if d.enc.compose {
+			d.nbuf = len(composeKana(d.buf[:d.nbuf], &d.composed))
+			if d.readErr == nil {
+				// The end of the buffer may be combined with a mark in the next chunk.
+				d.nhold = holdBack(d.buf[:d.nbuf])
+				d.nbuf -= d.nhold
+			}
+		} else if d.readErr == nil {
+			// The incomplete rune at the end is decoded with the next chunk.
+			d.nhold = incompleteRune(d.buf[:d.nbuf])
+			d.nbuf -= d.nhold
 		}
-		if d.state.v < 64 {
-			d.lastRune = d.n + 1
+		if d.enc.ignoreInvalid {
+			// Drop the unknown runes, and move the held bytes after the rest.
+			nbuf := len(d.enc.dropInvalid(d.buf[:d.nbuf], &d.dropped))
+			copy(d.buf[nbuf:], d.buf[d.nbuf:d.nbuf+d.nhold])
+			d.nbuf = nbuf
 		}
+		if d.base == 0 && d.pos == 0 {
+			if n := bomLen(d.enc, d.buf[:d.nbuf]); n > 0 {
+				d.pos = n
+				d.lastBlock.offset, d.lastRune.offset = int64(n), int64(n)
+			}
+		}
+		if d.nbuf > 0 || d.readErr != nil || d.paused() {
+			break
+		}
+	}
+}
+
+// readTrail checks the input after the final block.
+// d.state walks the trail of the stream,
+// and d.lastRune is the position of the rune being checked.
+func (d *decoder) readTrail() error {
+	for ; d.pos < d.nbuf; d.pos++ {
+		d.state = d.state.next(d.buf[d.pos])
+		if d.state == nil {
+			// trailing garbage
+			d.err = d.mark(d.lastRune).error(ErrTrailingGarbage)
+			return d.err
+		}
+		if d.state.v == rootNode {
+			d.lastRune.offset = d.base + int64(d.pos) + 1
+		}
+	}
+	d.err = d.readErr
+	if errors.Is(d.err, io.EOF) && d.state.v != rootNode {
+		// trailing garbage
+		d.err = d.mark(d.lastRune).error(ErrTrailingGarbage)
 	}
+	return d.err
+}
+
+// endStream handles the end of a padded stream.
+// The decoder expects the end of the input, or the next stream if the encoding concatenates them.
+func (d *decoder) endStream() {
+	if !d.enc.concat {
+		d.expectEOF = true
+		return
+	}
+	d.padCount = 0
+	d.state = d.enc.dfa.root
+}
+
+// finish handles the end of the input after a Read consumed the available input.
+func (d *decoder) finish(p []byte, n int) (int, error) {
 	d.err = d.readErr
 	if errors.Is(d.err, io.EOF) {
 		if d.state.v < 0 && d.state.v != rootNode {
-			// invalid rune
-			d.err = CorruptInputError(d.n)
+			// the input ends in the middle of a rune;
+			// it is reported before the incomplete block as Decode does.
+			d.err = d.markIn(runeStart(d.buf, d.pos)).error(ErrInvalidUTF8)
+			return n, d.err
 		}
 
 		// handle remaining bytes and padding
 		if d.ndbuf > 0 {
 			if d.enc.padChar != NoPadding {
 				if d.padCount == 0 {
-					d.err = CorruptInputError(d.lastBlock)
+					d.err = d.mark(d.lastBlock).error(ErrTruncated)
 				} else {
-					d.err = CorruptInputError(d.n)
+					d.err = d.markIn(d.pos).error(ErrTruncated)
 				}
 				return n, d.err
 			}
@@ -639,35 +2289,134 @@ func (d *decoder) Read(p []byte) (n int, err error) {
 			val := uint(d.dbuf[0])<<18 | uint(d.dbuf[1])<<12 | uint(d.dbuf[2])<<6 | uint(d.dbuf[3])
 			switch d.ndbuf {
 			case 0, 1:
-				d.err = CorruptInputError(d.n)
+				d.err = d.markIn(d.pos).error(ErrTruncated)
 				return n, d.err
 			case 2:
-				p[0] = byte(val >> 16)
+				d.out[0] = byte(val >> 16)
 				if d.enc.strict && (val&0xFFFF) != 0 {
-					d.err = CorruptInputError(d.lastRune)
+					d.err = d.mark(d.lastRune).error(ErrTrailingBits)
 					return n, d.err
 				}
-				n += 1
+				d.nout = 1
 			case 3:
-				p[0] = byte(val >> 16)
-				p[1] = byte(val >> 8)
+				d.out[0] = byte(val >> 16)
+				d.out[1] = byte(val >> 8)
 				if d.enc.strict && (val&0xFF) != 0 {
-					d.err = CorruptInputError(d.lastRune)
+					d.err = d.mark(d.lastRune).error(ErrTrailingBits)
 					return n, d.err
 				}
-				n += 2
+				d.nout = 2
 			}
-
+			d.ndbuf = 0
 			d.expectEOF = true
+
+			nn := copy(p, d.out[:d.nout])
+			d.nout -= nn
+			copy(d.out[:], d.out[nn:])
+			n += nn
+			if d.nout > 0 {
+				// report the error after the leftover.
+				return n, nil
+			}
 		}
 	}
 	return n, d.err
 }
 
+// InputOffset returns the number of the raw input bytes that the decoder has consumed,
+// counted before the combining marks are composed and before the invalid runes are dropped
+// by WithKanaComposition and WithIgnoreInvalid.
+// The bytes read ahead into the buffer but not yet decoded are not counted.
+// After Read returns an error, the offset stays where the decoder stopped until Reset:
+// at or after ByteOffset of the *DecodeError, no further than the end of the offending rune,
+// or at the end of the input for ErrTruncated.
+func (d *decoder) InputOffset() int64 {
+	return d.rawBase + int64(d.raw(d.pos))
+}
+
+// raw returns the position in the raw input of buf[pos], relative to buf[0].
+func (d *decoder) raw(pos int) int {
+	return d.composed.raw(d.dropped.raw(pos))
+}
+
+// Reset discards the decoder's state and makes it equivalent to
+// the result of NewDecoder with the same Encoding and r.
+func (d *decoder) Reset(r io.Reader) {
+	d.r = r
+	d.state = d.enc.buildOnce().root
+	d.err = nil
+	d.readErr = nil
+
+	d.base = 0
+	d.rawBase = 0
+	d.composed, d.dropped = d.composed[:0], d.dropped[:0]
+	d.runeBase = 0
+	d.padCount = 0
+	d.lastBlock = position{}
+	d.lastRune = position{}
+	d.pos = 0
+	d.nbuf = 0
+	d.nhold = 0
+	d.expectEOF = false
+	d.nlook = 0
+
+	d.dbuf = [4]byte{}
+	d.ndbuf = 0
+	d.out = [3]byte{}
+	d.nout = 0
+}
+
+// Decoder is the interface implemented by the stream decoder returned by NewDecoder.
+type Decoder interface {
+	io.Reader
+
+	// Reset discards the decoder's state and makes it read from r.
+	// This permits reusing a decoder rather than allocating a new one.
+	Reset(r io.Reader)
+
+	// InputOffset returns the number of bytes read from the underlying reader that the decoder has consumed.
+	// After Read returns a *DecodeError, it is the position in the whole stream
+	// where the decoder stopped, which may be after ByteOffset of the error.
+	// It doesn't count the bytes that the decoder has read ahead into its buffer.
+	InputOffset() int64
+}
+
 // NewDecoder constructs a new base64 stream decoder.
+// The returned decoder implements Decoder, so it can be reused by Reset.
 func NewDecoder(enc *Encoding, r io.Reader) io.Reader {
-	enc.buildOnce()
-	return &decoder{enc: enc, r: r, state: enc.root}
+	return NewDecoderSize(enc, r, decodeBufSize)
+}
+
+// decodeBufSize is the default size of the input buffer of the stream decoder.
+const decodeBufSize = 4096
+
+// NewDecoderSize is like NewDecoder but the decoder reads its input into a buffer of bufSize bytes.
+// A larger buffer reduces the calls of r.Read, and a smaller one saves memory.
+// bufSize is raised to the minimum that the decoder needs, a block and a few runes, if it is smaller.
+func NewDecoderSize(enc *Encoding, r io.Reader, bufSize int) io.Reader {
+	// A refill reads a block after the bytes held back from the last refill,
+	// which are a kana and an incomplete rune at most.
+	if minSize := 4*enc.maxSize + 2*utf8.UTFMax; bufSize < minSize {
+		bufSize = minSize
+	}
+	if enc.checksum != nil {
+		d := NewDecoderSize(enc.withoutChecksum(), r, bufSize).(Decoder)
+		return &checksumDecoder{d: d, enc: enc}
+	}
+	return &decoder{enc: enc, r: r, state: enc.buildOnce().root, buf: make([]byte, bufSize)}
+}
+
+// AppendDecode appends the base64dq decoded src to dst
+// and returns the extended buffer.
+// If the input is malformed, it returns dst unchanged and a *DecodeError.
+func (enc *Encoding) AppendDecode(dst, src []byte) ([]byte, error) {
+	n := enc.DecodedLen(len(src))
+	dst = grow(dst, n)
+	n, err := enc.Decode(dst[len(dst):][:n], src)
+	if err != nil {
+		return dst, err
+	}
+	return dst[:len(dst)+n], nil
 }
 
 // DecodeString returns the bytes represented by the base64 string s.
@@ -677,13 +2426,101 @@ func (enc *Encoding) DecodeString(s string) ([]byte, error) {
 	return dbuf[:n], err
 }
 
+// DecodeWriter decodes s and writes the decoded data to w,
+// reusing a small buffer instead of allocating the whole decoded data.
+// It writes the decoded data in chunks while decoding s,
+// and stops writing at the first error in s or from w.
+// It returns the number of bytes written and the error.
+func (enc *Encoding) DecodeWriter(w io.Writer, s string) (int, error) {
+	if enc.checksum != nil {
+		// the checksum needs the whole data before writing anything.
+		data, err := enc.DecodeString(s)
+		if err != nil {
+			return 0, err
+		}
+		return w.Write(data)
+	}
+
+	var buf [510]byte // a multiple of 3, so that the chunks are full
+	f := &chunkWriter{w: w}
+	k, err := decode(enc, buf[:], s, true, f)
+	if err != nil {
+		return f.n, err
+	}
+	if k > 0 {
+		f.flush(buf[:], &k)
+	}
+	return f.n, f.err
+}
+
+// DecodeStringInto is like DecodeString but decodes s into dst, overwriting its contents,
+// and returns the populated slice.
+// It allocates a new slice only if the capacity of dst is not enough,
+// so dst can be reused across many decodes.
+func (enc *Encoding) DecodeStringInto(dst []byte, s string) ([]byte, error) {
+	dst = grow(dst[:0], enc.DecodedLenString(s))
+	n, err := decode(enc, dst[:cap(dst)], s, true, nil)
+	return dst[:n], err
+}
+
 // DecodedLen returns the maximum length in bytes of the decoded data
 // corresponding to n bytes of base64-encoded data.
 func (enc *Encoding) DecodedLen(n int) int {
-	if enc.padChar == NoPadding {
-		// Unpadded data may end with partial block of 2-3 characters.
+	if enc.padChar == NoPadding || enc.singlePad {
+		// Unpadded data may end with partial block of 2-3 characters,
+		// and a single padding doesn't fill the final block either.
 		return n * 6 / 8
 	}
 	// Padded base64 should always be a multiple of 4 characters in length.
 	return n / 4 * 3
 }
+
+// DecodedLenString returns the exact length in bytes of the data
+// that Decode writes for the base64dq data s.
+// Unlike DecodedLen, which is an upper bound for any n bytes of input,
+// it counts the runes of s, so it never over-allocates for multi-byte alphabets.
+// If s is not valid, the result is the length of the data before the corruption.
+// If the encoding has a checksum, the result includes the checksum byte.
+func (enc *Encoding) DecodedLenString(s string) int {
+	if enc.compose && hasCombiningMark(s) {
+		s = string(composeKana([]byte(s), nil))
+	}
+	if enc.ignoreInvalid {
+		s = string(enc.dropInvalid([]byte(s), nil))
+	}
+
+	n := enc.buildOnce().root
+	total := 0
+	count := 0
+	padded := false // whether the padding ends the current stream
+	for i := bomLen(enc, s); i < len(s); i++ {
+		n = n.next(s[i])
+		if n == nil {
+			break
+		}
+		if n.v >= 0 && n.v < 64 {
+			if padded {
+				// the next stream of the concatenated streams.
+				total += count * 6 / 8
+				count = 0
+				padded = false
+			}
+			count++
+		}
+		if n.v == paddingNode && enc.concat {
+			padded = true
+			n = enc.dfa.root
+		}
+	}
+	return total + count*6/8
+}
+
+// grow grows b's capacity, if necessary, to guarantee space for another n bytes.
+func grow(b []byte, n int) []byte {
+	if n <= cap(b)-len(b) {
+		return b
+	}
+	buf := make([]byte, len(b), len(b)+n)
+	copy(buf, b)
+	return buf
+}
@@ -1,11 +1,19 @@
 package base64dq
 
 import (
+	"bufio"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
 )
 
 type testpair struct {
@@ -194,6 +202,39 @@ func rawRef(ref string) string {
 	return strings.TrimRight(ref, "・")
 }
 
+// Convert a reference string to the emoji alphabet
+func emojiRef(ref string) string {
+	return emojiReplacer.Replace(ref)
+}
+
+// Convert a reference string to raw, unpadded format of the emoji alphabet
+func rawEmojiRef(ref string) string {
+	return emojiReplacer.Replace(rawRef(ref))
+}
+
+// Convert a reference string to the URL safe alphabet
+func urlRef(ref string) string {
+	return urlReplacer.Replace(ref)
+}
+
+// Convert a reference string to raw, unpadded format of the URL safe alphabet
+func rawURLRef(ref string) string {
+	return urlReplacer.Replace(rawRef(ref))
+}
+
+var emojiReplacer = newAlphabetReplacer(encodeEmoji)
+var urlReplacer = newAlphabetReplacer(encodeURL)
+
+// newAlphabetReplacer returns a replacer converting the standard alphabet to alphabet.
+func newAlphabetReplacer(alphabet string) *strings.Replacer {
+	std, to := []rune(encodeStd), []rune(alphabet)
+	var oldnew []string
+	for i := range std {
+		oldnew = append(oldnew, string(std[i]), string(to[i]))
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
 type encodingTest struct {
 	enc  *Encoding           // Encoding to test
 	conv func(string) string // Reference string converter
@@ -204,6 +245,10 @@ var encodingTests = []encodingTest{
 	{RawStdEncoding, rawRef},
 	{StdEncoding.Strict(), stdRef},
 	{RawStdEncoding.Strict(), rawRef},
+	{EmojiEncoding, emojiRef},
+	{RawEmojiEncoding, rawEmojiRef},
+	{URLEncoding, urlRef},
+	{RawURLEncoding, rawURLRef},
 }
 
 var bigtest = testpair{
@@ -231,6 +276,143 @@ func TestEncode(t *testing.T) {
 	}
 }
 
+func TestEncodeStringToString(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			if got := tt.enc.EncodeStringToString(p.decoded); got != tt.conv(p.encoded) {
+				t.Errorf("EncodeStringToString(%q) = %q, want %q", p.decoded, got, tt.conv(p.encoded))
+			}
+		}
+	}
+	for _, n := range []int{191, 192, 193, 1000} {
+		s := strings.Repeat("x", n)
+		for _, enc := range []*Encoding{StdEncoding, StdEncoding.WithChecksum(xorSum)} {
+			if got, want := enc.EncodeStringToString(s), enc.EncodeToString([]byte(s)); got != want {
+				t.Errorf("EncodeStringToString(%d bytes) = %q, want %q", n, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodeToBuilder(t *testing.T) {
+	for _, tt := range encodingTests {
+		var b strings.Builder
+		var want string
+		for _, p := range pairs {
+			tt.enc.EncodeToBuilder(&b, []byte(p.decoded))
+			want += tt.conv(p.encoded)
+		}
+		if got := b.String(); got != want {
+			t.Errorf("EncodeToBuilder = %q, want %q", got, want)
+		}
+	}
+	for _, n := range []int{191, 192, 193, 1000} {
+		src := []byte(strings.Repeat("x", n))
+		for _, enc := range []*Encoding{StdEncoding, StdEncoding.WithChecksum(xorSum)} {
+			var b strings.Builder
+			b.WriteString("prefix:")
+			enc.EncodeToBuilder(&b, src)
+			if got, want := b.String(), "prefix:"+enc.EncodeToString(src); got != want {
+				t.Errorf("EncodeToBuilder(%d bytes) = %q, want %q", n, got, want)
+			}
+		}
+	}
+
+	src := []byte(bigtest.decoded)
+	var b strings.Builder
+	allocs := testing.AllocsPerRun(100, func() {
+		b.Reset()
+		StdEncoding.EncodeToBuilder(&b, src)
+	})
+	if allocs != 1 {
+		t.Errorf("EncodeToBuilder allocates %v times, want 1", allocs)
+	}
+
+	enc := StdEncoding.WithChecksum(xorSum)
+	allocs = testing.AllocsPerRun(100, func() {
+		b.Reset()
+		enc.EncodeToBuilder(&b, src)
+	})
+	if allocs != 1 {
+		t.Errorf("EncodeToBuilder with checksum allocates %v times, want 1", allocs)
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	var src [][]byte
+	for _, p := range pairs {
+		src = append(src, []byte(p.decoded))
+	}
+	for _, tt := range encodingTests {
+		got := tt.enc.EncodeBatch(nil, src)
+		if len(got) != len(pairs) {
+			t.Fatalf("EncodeBatch returns %d results, want %d", len(got), len(pairs))
+		}
+		for i, p := range pairs {
+			if string(got[i]) != tt.conv(p.encoded) {
+				t.Errorf("EncodeBatch[%d] = %q, want %q", i, got[i], tt.conv(p.encoded))
+			}
+		}
+	}
+
+	// appending to a result doesn't overwrite the others.
+	got := StdEncoding.EncodeBatch(nil, [][]byte{[]byte("foo"), []byte("bar")})
+	_ = append(got[0], "!"...)
+	if string(got[1]) != "のらかじ" {
+		t.Errorf("EncodeBatch[1] = %q, want %q", got[1], "のらかじ")
+	}
+
+	// the slice of the results is reused.
+	got2 := StdEncoding.EncodeBatch(got, [][]byte{[]byte("f")})
+	if len(got2) != 1 || &got2[0] != &got[0] || string(got2[0]) != "はむ・・" {
+		t.Errorf("EncodeBatch = %q, want [%q] in the same slice", got2, "はむ・・")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		got = StdEncoding.EncodeBatch(got, src)
+	})
+	if allocs != 1 {
+		t.Errorf("EncodeBatch allocates %v times, want 1", allocs)
+	}
+}
+
+func TestAppendEncode(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			prefix := []byte("prefix:")
+			got := tt.enc.AppendEncode(prefix, []byte(p.decoded))
+			want := "prefix:" + tt.conv(p.encoded)
+			if string(got) != want {
+				t.Errorf("AppendEncode(%q) = %q, want %q", p.decoded, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodeSafe(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			size := tt.enc.EncodedLen(len(p.decoded))
+			dst := make([]byte, size)
+			n, err := tt.enc.EncodeSafe(dst, []byte(p.decoded))
+			if err != nil {
+				t.Errorf("EncodeSafe(%q) = %v", p.decoded, err)
+			}
+			if string(dst[:n]) != tt.conv(p.encoded) {
+				t.Errorf("EncodeSafe(%q) = %q, want %q", p.decoded, dst[:n], tt.conv(p.encoded))
+			}
+
+			if size == 0 {
+				continue
+			}
+			n, err = tt.enc.EncodeSafe(dst[:size-1], []byte(p.decoded))
+			if n != 0 || err != ErrShortBuffer {
+				t.Errorf("EncodeSafe(%q) into %d bytes = %d, %v, want 0, %v", p.decoded, size-1, n, err, ErrShortBuffer)
+			}
+		}
+	}
+}
+
 func TestEncoder(t *testing.T) {
 	for _, p := range pairs {
 		bb := &strings.Builder{}
@@ -247,6 +429,99 @@ func TestEncoder(t *testing.T) {
 	}
 }
 
+// writeRecorder records the sizes of the writes.
+type writeRecorder struct {
+	strings.Builder
+	sizes []int
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+	return w.Builder.Write(p)
+}
+
+func TestNewEncoderSize(t *testing.T) {
+	input := strings.Repeat(bigtest.decoded, 10)
+	want := StdEncoding.EncodeToString([]byte(input))
+	for _, bufSize := range []int{-1, 0, 1, 12, 13, 100, 1024, 8192} {
+		w := &writeRecorder{}
+		encoder := NewEncoderSize(StdEncoding, w, bufSize)
+		if _, err := encoder.Write([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if w.String() != want {
+			t.Errorf("bufSize %d: Encode(%q) = %q, want %q", bufSize, input, w.String(), want)
+		}
+
+		limit := bufSize
+		if limit < 4*StdEncoding.maxSize {
+			limit = 4 * StdEncoding.maxSize
+		}
+		for _, size := range w.sizes {
+			if size > limit {
+				t.Errorf("bufSize %d: write of %d bytes exceeds the buffer", bufSize, size)
+			}
+		}
+	}
+}
+
+func TestEncoderReset(t *testing.T) {
+	bb := &strings.Builder{}
+	encoder := NewEncoder(StdEncoding, bb).(Encoder)
+
+	// leave a partial block in the encoder, and reset it.
+	if _, err := encoder.Write([]byte("fo")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pairs {
+		bb.Reset()
+		encoder.Reset(bb)
+		if _, err := encoder.Write([]byte(p.decoded)); err != nil {
+			t.Errorf("Encoder.Write(%q) error: %v", p.decoded, err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Error("Encoder.Close() error:", err)
+		}
+		if bb.String() != p.encoded {
+			t.Errorf("Encode(%q) = %q, want %q", p.decoded, bb.String(), p.encoded)
+		}
+	}
+}
+
+func TestEncoderFlush(t *testing.T) {
+	bb := &strings.Builder{}
+	bw := bufio.NewWriter(bb)
+	encoder := NewEncoder(StdEncoding, bw).(Encoder)
+
+	if _, err := encoder.Write([]byte("foob")); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// the complete block "foo" is written, and "b" is pending.
+	if got, want := bb.String(), StdEncoding.EncodeToString([]byte("foo")); got != want {
+		t.Errorf("after Flush() = %q, want %q", got, want)
+	}
+
+	// the encoder continues after Flush.
+	if _, err := encoder.Write([]byte("ar")); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bb.String(), StdEncoding.EncodeToString([]byte("foobar")); got != want {
+		t.Errorf("after Close() = %q, want %q", got, want)
+	}
+}
+
 func TestEncoderBuffering(t *testing.T) {
 	input := []byte(bigtest.decoded)
 	for bs := 1; bs <= 12; bs++ {
@@ -274,186 +549,1523 @@ func TestEncoderBuffering(t *testing.T) {
 	}
 }
 
-const emoji = "😀😃😄😁😆😅😂🙂🙃😉😊😇😍😘😗☺️😚😙😋😛😜😝🤑🤗🤔🤐😐😑😶😏😒🙄😬😌😔😪😴😷🤒🤕😵😎🤓😕😟🙁☹️😮😯😲😳😦😧😨😰😥😢😭😱😖😣😞"
-
-var emojiEncode = NewEncoding(emoji)
+func TestBlockEncoder(t *testing.T) {
+	input := []byte(bigtest.decoded)
+	for _, enc := range []*Encoding{StdEncoding, RawStdEncoding, EmojiEncoding, StdEncoding.WithChecksum(xorSum)} {
+		for bs := 1; bs <= 12; bs++ {
+			w := &writeRecorder{}
+			encoder := NewBlockEncoder(enc, w)
+			for pos := 0; pos < len(input); pos += bs {
+				end := pos + bs
+				if end > len(input) {
+					end = len(input)
+				}
+				before := len(w.sizes)
+				n, err := encoder.Write(input[pos:end])
+				if err != nil || n != end-pos {
+					t.Errorf("Write(%q) = %d, %v, want %d", input[pos:end], n, err, end-pos)
+				}
+				if len(w.sizes) > before+1 {
+					t.Errorf("Write(%q) called w.Write %d times", input[pos:end], len(w.sizes)-before)
+				}
+			}
+			// the writes before Close are complete blocks.
+			out := w.String()
+			for _, size := range w.sizes {
+				if s := out[:size]; !utf8.ValidString(s) || utf8.RuneCountInString(s)%4 != 0 {
+					t.Errorf("%v: w.Write(%q) is not a set of blocks", enc, s)
+				}
+				out = out[size:]
+			}
 
-func TestEncode_Emoji(t *testing.T) {
-	for _, p := range pairs {
-		encoded := emojiEncode.EncodeToString([]byte(p.decoded))
-		t.Log(encoded)
+			if err := encoder.Close(); err != nil {
+				t.Error("Close gave error:", err)
+			}
+			got := w.String()
+			if want := enc.EncodeToString(input); got != want {
+				t.Errorf("%v: Encoding/%d of %q = %q, want %q", enc, bs, input, got, want)
+			}
+		}
 	}
 }
 
-func TestEncodedLen(t *testing.T) {
+// hiragana2katakana converts hiragana in s to katakana.
+func hiragana2katakana(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ぁ' && r <= 'ゖ' {
+			return r + 0x60
+		}
+		return r
+	}, s)
+}
+
+func TestKatakanaEncoding(t *testing.T) {
 	for _, tt := range []struct {
 		enc  *Encoding
-		n    int
-		want int
+		conv func(string) string
 	}{
-		// Japanese hiragana has 3 bytes per character in utf-8.
-		// So we need 3 times larger buffer than the standard base64.
-		{RawStdEncoding, 0, 0},
-		{RawStdEncoding, 1, 2 * 3},
-		{RawStdEncoding, 2, 3 * 3},
-		{RawStdEncoding, 3, 4 * 3},
-		{RawStdEncoding, 7, 10 * 3},
-
-		// We need 3 times larger buffer than the standard base64.
-		{StdEncoding, 0, 0},
-		{StdEncoding, 1, 4 * 3},
-		{StdEncoding, 2, 4 * 3},
-		{StdEncoding, 3, 4 * 3},
-		{StdEncoding, 4, 8 * 3},
-		{StdEncoding, 7, 12 * 3},
-
-		// Emoji has 4 bytes per character in utf-8.
-		// We need larger buffer than Japanese hiragana.
-		{emojiEncode, 0, 0},
-		{emojiEncode, 1, 4 * 4},
-		{emojiEncode, 2, 4 * 4},
-		{emojiEncode, 3, 4 * 4},
-		{emojiEncode, 4, 8 * 4},
-		{emojiEncode, 7, 12 * 4},
+		{KatakanaEncoding, stdRef},
+		{RawKatakanaEncoding, rawRef},
 	} {
-		if got := tt.enc.EncodedLen(tt.n); got != tt.want {
-			t.Errorf("EncodedLen(%d): got %d, want %d", tt.n, got, tt.want)
+		for _, p := range pairs {
+			want := hiragana2katakana(tt.conv(p.encoded))
+			encoded := tt.enc.EncodeToString([]byte(p.decoded))
+			if encoded != want {
+				t.Errorf("Encode(%q) = %q, want %q", p.decoded, encoded, want)
+			}
+			decoded, err := tt.enc.DecodeString(want)
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", want, err)
+			}
+			if string(decoded) != p.decoded {
+				t.Errorf("Decode(%q) = %q, want %q", want, decoded, p.decoded)
+			}
 		}
 	}
 }
 
-func TestDecode(t *testing.T) {
-	for _, p := range pairs {
-		for _, tt := range encodingTests {
-			encoded := tt.conv(p.encoded)
-			decoded, err := tt.enc.DecodeString(encoded)
+func TestHankakuKatakanaEncoding(t *testing.T) {
+	if got := HankakuKatakanaEncoding.maxSize; got != 3 {
+		t.Errorf("maxSize = %d, want 3", got)
+	}
+	if got := HankakuKatakanaEncoding.PaddingChar(); got != HankakuPadding {
+		t.Errorf("PaddingChar() = %q, want %q", got, HankakuPadding)
+	}
+
+	for _, tt := range []struct {
+		data    string
+		encoded string
+	}{
+		{"", ""},
+		{"f", "ﾊﾑ･･"},
+		{"fo", "ﾊﾗ｣･"},
+		{"foo", "ﾊﾗ､ｨ"},
+		{"foob", "ﾊﾗ､ｨﾉﾑ･･"},
+		{"\xff\xff\xff", "￮￮￮￮"},
+	} {
+		for _, enc := range []*Encoding{HankakuKatakanaEncoding, RawHankakuKatakanaEncoding} {
+			want := tt.encoded
+			if enc.PaddingChar() == NoPadding {
+				want = strings.TrimRight(want, "･")
+			}
+			if got := enc.EncodedLen(len(tt.data)); got < len(want) {
+				t.Errorf("EncodedLen(%d) = %d, want >= %d", len(tt.data), got, len(want))
+			}
+			encoded := enc.EncodeToString([]byte(tt.data))
+			if encoded != want {
+				t.Errorf("Encode(%q) = %q, want %q", tt.data, encoded, want)
+			}
+			decoded, err := enc.DecodeString(encoded)
 			if err != nil {
-				t.Errorf("Decode(%q) = %v", p.encoded, err)
+				t.Errorf("Decode(%q) = %v", encoded, err)
 			}
-			if string(decoded) != string(p.decoded) {
-				t.Errorf("Decode(%q) = %q, want %q", p.encoded, decoded, p.decoded)
+			if string(decoded) != tt.data {
+				t.Errorf("Decode(%q) = %q, want %q", encoded, decoded, tt.data)
 			}
 		}
 	}
+}
 
-	// test compatibility with standard base64
+const emoji = "😀😃😄😁😆😅😂🙂🙃😉😊😇😍😘😗☺😚😙😋😛😜😝🤑🤗🤔🤐😐😑😶😏😒🙄😬😌😔😪😴😷🤒🤕😵😎🤓😕😟🙁☹😮😯😲😳😦😧😨😰😥😢😭😱😖😣😞🤠🥳"
+
+var emojiEncode = NewEncoding(emoji)
+
+func TestEncode_Emoji(t *testing.T) {
 	for _, p := range pairs {
-		decoded, err := StdEncoding.DecodeString(p.encoded)
-		if err != nil {
-			t.Errorf("Decode(%q) = %v", p.encoded, err)
-		}
-		decoded2, err := base64.StdEncoding.DecodeString(dq2std.Replace(p.encoded))
-		if err != nil {
-			t.Errorf("Decode(%q) = %v", p.encoded, err)
-		}
-		if string(decoded) != string(decoded2) {
-			t.Errorf("Decode(%q) = %q, want %q", p.encoded, decoded, decoded2)
-		}
+		encoded := emojiEncode.EncodeToString([]byte(p.decoded))
+		t.Log(encoded)
 	}
 }
 
-var decodeCorruptTestCases = []struct {
-	input  string
-	offset int // -1 means no corruption.
-}{
-	{"", -1},
-	{"\n", -1},
-	{"あああ・\n", -1},
-	{"ああああ\n", -1},
-	{"\xff", 0},
-	{"！！！！", 0},
-	{"・・・・", 0},
-	{"が・・・", len("が")},
-	{"・あああ", 0},
-	{"あ・ああ", len("あ")},
-	{"ああ・あ", len("ああ")},
-	{"ああ・・あ", len("ああ・・")},
-	{"あああ・ああああ", len("あああ・")},
-	{"あああああ", len("ああああ")},
-	{"ああああああ", len("ああああ")},
-	{"あ・", len("あ")},
-	{"あ・・", len("あ")},
-	{"ああ・", len("ああ・")},
-	{"ああ・・", -1},
-	{"あああ・", -1},
-	{"ああああ", -1},
-	{"ああああああ・", len("ああああああ・")},
-	{"ふるいけやか・・・・・", len("ふるいけやか・・")},
-	{"あ！\n", len("あ")},
-	{"あ・\n", len("あ")},
-}
-
-func TestDecodeCorrupt(t *testing.T) {
-	for _, tc := range decodeCorruptTestCases {
-		dbuf := make([]byte, StdEncoding.DecodedLen(len(tc.input)))
-		_, err := StdEncoding.Decode(dbuf, []byte(tc.input))
-		if tc.offset == -1 {
-			if err != nil {
-				t.Error("Decoder wrongly detected corruption in", tc.input)
-			}
-			continue
-		}
-		switch err := err.(type) {
-		case CorruptInputError:
-			if int(err) != tc.offset {
-				t.Errorf("Decoder wrongly detected corruption in %q at offset %d, want %d", tc.input, err, tc.offset)
-			}
-		default:
-			t.Error("Decoder failed to detect corruption in", tc)
+func TestAlphabet(t *testing.T) {
+	for _, tt := range []struct {
+		enc  *Encoding
+		want string
+	}{
+		{StdEncoding, encodeStd},
+		{RawStdEncoding, encodeStd},
+		{NameEncoding, encodeName},
+		{emojiEncode, emoji},
+		{EmojiEncoding, "😀😁😂😃😄😅😆😇😈😉😊😋😌😍😎😏😐😑😒😓😔😕😖😗😘😙😚😛😜😝😞😟😠😡😢😣😤😥😦😧😨😩😪😫😬😭😮😯😰😱😲😳😴😵😶😷😸😹😺😻😼😽😾😿"},
+	} {
+		if got := tt.enc.Alphabet(); got != tt.want {
+			t.Errorf("Alphabet() = %q, want %q", got, tt.want)
 		}
 	}
 }
 
-func TestDecoder(t *testing.T) {
-	for _, p := range pairs {
-		decoder := NewDecoder(StdEncoding, strings.NewReader(p.encoded))
-		dbuf := make([]byte, StdEncoding.DecodedLen(len(p.encoded)))
-		count, err := decoder.Read(dbuf)
-		if err != nil && err != io.EOF {
-			t.Fatalf("Read from %q failed: %v", p.encoded, err)
-		}
-		if count != len(p.decoded) {
-			t.Errorf("Read from %q = length %v, want %v", p.encoded, count, len(p.decoded))
+func TestURLEncoding(t *testing.T) {
+	for _, r := range URLEncoding.Alphabet() + string(URLEncoding.PaddingChar()) {
+		if strings.ContainsRune(`!#$&'()*+,/:;=?@[]\"<>|`, r) || r <= ' ' || r == 0x7F {
+			t.Errorf("%q is a reserved character", r)
 		}
-		if string(dbuf[0:count]) != p.decoded {
-			t.Errorf("Decoding of %q = %q, want %q", p.encoded, string(dbuf[0:count]), p.decoded)
+		if r == voicedMark || r == semiVoicedMark {
+			t.Errorf("%q is a combining mark", r)
 		}
-		if err != io.EOF {
-			count, err = decoder.Read(dbuf)
-			if count != 0 {
-				t.Errorf("Read after EOF from %q = %d, want 0", p.encoded, count)
+		for _, c := range composedKana {
+			if r == c {
+				t.Errorf("%q is decomposed by the Unicode normalization", r)
 			}
 		}
-		if err != io.EOF {
-			t.Errorf("Read from %q = %v, want %v", p.encoded, err, io.EOF)
-		}
+	}
+
+	encoded := URLEncoding.EncodeToString([]byte(bigtest.decoded))
+	if got, err := url.PathUnescape(url.PathEscape(encoded)); err != nil || got != encoded {
+		t.Errorf("PathUnescape(PathEscape(%q)) = %q, %v", encoded, got, err)
+	}
+	if got, err := url.QueryUnescape(url.QueryEscape(encoded)); err != nil || got != encoded {
+		t.Errorf("QueryUnescape(QueryEscape(%q)) = %q, %v", encoded, got, err)
 	}
 }
 
-func TestDecoderCorrupt(t *testing.T) {
-	for _, tc := range decodeCorruptTestCases {
-		decoder := NewDecoder(StdEncoding, strings.NewReader(tc.input))
-		_, err := io.ReadAll(decoder)
-		if tc.offset == -1 {
-			if err != nil {
-				t.Errorf("Decoder wrongly detected corruption in %q: %v", tc.input, err)
-			}
-			continue
-		}
-		switch err := err.(type) {
-		case CorruptInputError:
-			if int(err) != tc.offset {
-				t.Errorf("Decoder wrongly detected corruption in %q at offset %d, want %d", tc.input, err, tc.offset)
-			}
-		default:
-			t.Error("Decoder failed to detect corruption in", tc)
+func TestMaxRuneLen(t *testing.T) {
+	for _, tt := range []struct {
+		enc  *Encoding
+		want int
+	}{
+		{StdEncoding, 3},
+		{HankakuKatakanaEncoding, 3},
+		{emojiEncode, 4},
+		{EmojiEncoding, 4},
+		{URLEncoding, 3},
+		{NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/").WithPadding('='), 1},
+		{NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"), 3},
+		{NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/").WithPadding('=').WithDecodePadding('😀'), 4},
+	} {
+		if got := tt.enc.MaxRuneLen(); got != tt.want {
+			t.Errorf("%v: MaxRuneLen() = %d, want %d", tt.enc, got, tt.want)
 		}
 	}
 }
 
-func TestDecoderBuffering(t *testing.T) {
-	for bs := 1; bs <= 12; bs++ {
-		decoder := NewDecoder(StdEncoding, strings.NewReader(bigtest.encoded))
+func TestPaddingChar(t *testing.T) {
+	for _, tt := range []struct {
+		enc  *Encoding
+		want rune
+	}{
+		{StdEncoding, StdPadding},
+		{RawStdEncoding, NoPadding},
+		{StdEncoding.WithPadding('='), '='},
+		{RawStdEncoding.Strict(), NoPadding},
+	} {
+		if got := tt.enc.PaddingChar(); got != tt.want {
+			t.Errorf("PaddingChar() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestIsStrict(t *testing.T) {
+	for _, tt := range []struct {
+		enc  *Encoding
+		want bool
+	}{
+		{StdEncoding, false},
+		{StdEncoding.Strict(), true},
+		{RawStdEncoding.StrictNoWhitespace(), true},
+		{StdEncoding.Strict().WithPadding('='), true},
+		{StdEncoding.Strict().Clone(), true},
+	} {
+		if got := tt.enc.IsStrict(); got != tt.want {
+			t.Errorf("%v: IsStrict() = %t, want %t", tt.enc, got, tt.want)
+		}
+	}
+}
+
+func TestNonStrict(t *testing.T) {
+	strict := StdEncoding.Strict()
+	enc := strict.NonStrict()
+	if enc.IsStrict() {
+		t.Error("NonStrict().IsStrict() = true")
+	}
+	if !enc.Equal(StdEncoding) {
+		t.Errorf("%v is not equal to %v", enc, StdEncoding)
+	}
+	if enc.dfa != strict.dfa {
+		t.Error("NonStrict doesn't share the DFA")
+	}
+	if _, err := strict.DecodeString("はめ・・"); !errors.Is(err, ErrTrailingBits) {
+		t.Errorf("strict DecodeString error = %v, want ErrTrailingBits", err)
+	}
+	if got, err := enc.DecodeString("はめ・・"); err != nil || string(got) != "f" {
+		t.Errorf("DecodeString = %q, %v, want %q", got, err, "f")
+	}
+
+	// CR and LF are still rejected.
+	if _, err := StdEncoding.StrictNoWhitespace().NonStrict().DecodeString("はむ\n・・"); !errors.Is(err, ErrInvalidRune) {
+		t.Errorf("DecodeString error = %v, want ErrInvalidRune", err)
+	}
+}
+
+func TestEncodingString(t *testing.T) {
+	for _, tt := range []struct {
+		enc  *Encoding
+		want string
+	}{
+		{StdEncoding, `base64dq.Encoding(alphabet="` + encodeStd + `", pad='・', strict=false)`},
+		{RawStdEncoding.Strict(), `base64dq.Encoding(alphabet="` + encodeStd + `", pad=none, strict=true)`},
+		{StdEncoding.WithPadding('='), `base64dq.Encoding(alphabet="` + encodeStd + `", pad='=', strict=false)`},
+	} {
+		if got := fmt.Sprint(tt.enc); got != tt.want {
+			t.Errorf("String() = %s, want %s", got, tt.want)
+		}
+	}
+
+	enc := NewEncoding(encodeStd)
+	_ = enc.String()
+	if enc.dfa.root != nil {
+		t.Error("String() built the DFA")
+	}
+}
+
+func TestDFAStats(t *testing.T) {
+	enc := NewEncoding(encodeStd)
+	nodes, bytes := enc.DFAStats()
+	if enc.dfa.root == nil {
+		t.Fatal("DFAStats didn't build the DFA")
+	}
+	// the root, the 64 alphabet runes, and the padding at least.
+	if nodes <= 65 || bytes < 256*strconv.IntSize/8 {
+		t.Errorf("DFAStats() = %d, %d, want more than 65 nodes and the root table", nodes, bytes)
+	}
+
+	// the derived encodings share the DFA.
+	if n, b := enc.Strict().DFAStats(); n != nodes || b != bytes {
+		t.Errorf("Strict().DFAStats() = %d, %d, want %d, %d", n, b, nodes, bytes)
+	}
+
+	// the ignored runes add the states.
+	if n, b := enc.WithIgnoredRunes('　').DFAStats(); n <= nodes || b <= bytes {
+		t.Errorf("WithIgnoredRunes().DFAStats() = %d, %d, want more than %d, %d", n, b, nodes, bytes)
+	}
+}
+
+func TestPrebuild(t *testing.T) {
+	enc := NewEncoding(encodeStd)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			enc.Prebuild()
+		}()
+	}
+	wg.Wait()
+	root := enc.dfa.root
+	if root == nil {
+		t.Fatal("Prebuild didn't build the DFA")
+	}
+
+	enc.Prebuild()
+	if enc.dfa.root != root {
+		t.Error("Prebuild rebuilt the DFA")
+	}
+	decoded, err := enc.DecodeString(bigtest.encoded)
+	if err != nil || string(decoded) != bigtest.decoded {
+		t.Errorf("DecodeString() = %q, %v, want %q", decoded, err, bigtest.decoded)
+	}
+}
+
+func TestClone(t *testing.T) {
+	for _, tt := range encodingTests {
+		enc := tt.enc.Clone()
+		if enc == tt.enc {
+			t.Error("Clone() returned the same pointer")
+		}
+		if enc.Alphabet() != tt.enc.Alphabet() {
+			t.Errorf("Clone().Alphabet() = %q, want %q", enc.Alphabet(), tt.enc.Alphabet())
+		}
+		if enc.PaddingChar() != tt.enc.PaddingChar() {
+			t.Errorf("Clone().PaddingChar() = %q, want %q", enc.PaddingChar(), tt.enc.PaddingChar())
+		}
+		if enc.strict != tt.enc.strict {
+			t.Errorf("Clone().strict = %t, want %t", enc.strict, tt.enc.strict)
+		}
+		for _, p := range pairs {
+			decoded, err := enc.DecodeString(tt.conv(p.encoded))
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", p.encoded, err)
+			}
+			if string(decoded) != p.decoded {
+				t.Errorf("Decode(%q) = %q, want %q", p.encoded, decoded, p.decoded)
+			}
+		}
+		if enc.dfa == tt.enc.dfa {
+			t.Error("Clone() shares the DFA with the original")
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	for _, tt := range []struct {
+		a, b *Encoding
+		want bool
+	}{
+		{StdEncoding, StdEncoding, true},
+		{StdEncoding, StdEncoding.Clone(), true},
+		{StdEncoding, NewEncoding(encodeStd), true},
+		{StdEncoding, StdEncoding.WithPadding(StdPadding), true},
+		{StdEncoding, RawStdEncoding, false},
+		{StdEncoding, StdEncoding.Strict(), false},
+		{StdEncoding, NameEncoding, false},
+		{StdEncoding, nil, false},
+		{nil, nil, true},
+		{StdEncoding.WithIgnoredRunes(' ', '　'), StdEncoding.WithIgnoredRunes('　', ' '), true},
+		{StdEncoding.WithIgnoredRunes(' '), StdEncoding.WithIgnoredRunes('　'), false},
+		{StdEncoding.WithIgnoredRunes(' '), StdEncoding, false},
+		{StdEncoding.WithAliases(map[rune]rune{'ア': 'あ'}), StdEncoding.WithAliases(map[rune]rune{'ア': 'あ'}), true},
+		{StdEncoding.WithAliases(map[rune]rune{'ア': 'あ'}), StdEncoding.WithAliases(map[rune]rune{'ア': 'い'}), false},
+		{StdEncoding.WithAliases(map[rune]rune{'ア': 'あ'}), StdEncoding, false},
+		{StdEncoding.WithKanaComposition(), StdEncoding, false},
+	} {
+		if got := tt.a.Equal(tt.b); got != tt.want {
+			t.Errorf("%v.Equal(%v) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+		if got := tt.b.Equal(tt.a); got != tt.want {
+			t.Errorf("%v.Equal(%v) = %t, want %t", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSharedDFA(t *testing.T) {
+	enc := NewEncoding(encodeStd)
+	strict := enc.Strict()
+	if strict.dfa != enc.dfa {
+		t.Error("Strict() doesn't share the DFA")
+	}
+	if enc.WithPadding(StdPadding).dfa != enc.dfa {
+		t.Error("WithPadding() with the same padding doesn't share the DFA")
+	}
+	if enc.WithPadding(NoPadding).dfa == enc.dfa {
+		t.Error("WithPadding() with another padding shares the DFA")
+	}
+
+	// the strictness still applies to the encoding sharing the DFA.
+	if _, err := enc.DecodeString("はめ・・"); err != nil {
+		t.Errorf("DecodeString() = %v", err)
+	}
+	if _, err := strict.DecodeString("はめ・・"); !errors.Is(err, ErrTrailingBits) {
+		t.Errorf("Strict().DecodeString() = %v, want %v", err, ErrTrailingBits)
+	}
+}
+
+var validAlphabetTests = []struct {
+	alphabet string
+	err      string
+}{
+	{encodeStd, ""},
+	{encodeName, ""},
+	{emoji, ""},
+	{encodeStd[:len(encodeStd)-len("ぼ")], "base64dq: encoding alphabet is not 64-runes long: expected 64 runes, got 63"},
+	{encodeStd + "ん", "base64dq: encoding alphabet is not 64-runes long: expected 64 runes, got 65"},
+	{encodeStd + encodeStd[:len("あいう")] + "\xff", "base64dq: encoding alphabet is not 64-runes long: expected 64 runes, got 68"},
+	{"\xff" + encodeStd[len("あ"):], "base64dq: encoding alphabet contains invalid UTF-8 sequence at rune index 0"},
+	{"い" + encodeStd[len("あ"):], "base64dq: encoding alphabet contains duplicated rune 'い' at rune index 1"},
+	{"・" + encodeStd[len("あ"):], "base64dq: encoding alphabet contains invalid rune '・' at rune index 0"},
+	{encodeStd[:len(encodeStd)-len("ぼ")] + "\n", "base64dq: encoding alphabet contains invalid rune '\\n' at rune index 63"},
+}
+
+func TestValidAlphabet(t *testing.T) {
+	for _, tt := range validAlphabetTests {
+		err := ValidAlphabet(tt.alphabet)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("ValidAlphabet(%q) returned error: %v", tt.alphabet, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("ValidAlphabet(%q) error = %v, want %q", tt.alphabet, err, tt.err)
+		}
+	}
+}
+
+func TestNewEncodingErr(t *testing.T) {
+	for _, tt := range validAlphabetTests {
+		enc, err := NewEncodingErr(tt.alphabet)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("NewEncodingErr(%q) returned error: %v", tt.alphabet, err)
+			} else if enc.Alphabet() != tt.alphabet {
+				t.Errorf("NewEncodingErr(%q).Alphabet() = %q", tt.alphabet, enc.Alphabet())
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("NewEncodingErr(%q) error = %v, want %q", tt.alphabet, err, tt.err)
+		}
+	}
+}
+
+func TestNewEncodingFromRunesErr(t *testing.T) {
+	std := []rune(encodeStd)
+	replace := func(i int, r rune) []rune {
+		runes := append([]rune(nil), std...)
+		runes[i] = r
+		return runes
+	}
+	for _, tt := range []struct {
+		alphabet []rune
+		err      string
+	}{
+		{std, ""},
+		{[]rune(emoji), ""},
+		{std[:63], "base64dq: encoding alphabet is not 64-runes long: expected 64 runes, got 63"},
+		{append(std, 'ん'), "base64dq: encoding alphabet is not 64-runes long: expected 64 runes, got 65"},
+		{replace(3, 0xD800), "base64dq: encoding alphabet contains invalid rune U+D800 at rune index 3"},
+		{replace(1, 'あ'), "base64dq: encoding alphabet contains duplicated rune 'あ' at rune index 1"},
+		{replace(63, '\r'), "base64dq: encoding alphabet contains invalid rune '\\r' at rune index 63"},
+	} {
+		enc, err := NewEncodingFromRunesErr(tt.alphabet)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("NewEncodingFromRunesErr(%q) returned error: %v", tt.alphabet, err)
+			} else if enc.Alphabet() != string(tt.alphabet) {
+				t.Errorf("NewEncodingFromRunesErr(%q).Alphabet() = %q", tt.alphabet, enc.Alphabet())
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("NewEncodingFromRunesErr(%q) error = %v, want %q", tt.alphabet, err, tt.err)
+		}
+	}
+}
+
+func TestWithPaddingErr(t *testing.T) {
+	for _, tt := range []struct {
+		padding rune
+		err     string
+	}{
+		{'=', ""},
+		{NoPadding, ""},
+		{StdPadding, ""},
+		{'\n', "base64dq: invalid padding rune '\\n'"},
+		{'\r', "base64dq: invalid padding rune '\\r'"},
+		{'あ', "base64dq: padding rune 'あ' present in alphabet at index 0"},
+		{'ぼ', "base64dq: padding rune 'ぼ' present in alphabet at index 63"},
+	} {
+		enc, err := StdEncoding.WithPaddingErr(tt.padding)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("WithPaddingErr(%q) returned error: %v", tt.padding, err)
+			} else if enc.PaddingChar() != tt.padding {
+				t.Errorf("WithPaddingErr(%q).PaddingChar() = %q", tt.padding, enc.PaddingChar())
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("WithPaddingErr(%q) error = %v, want %q", tt.padding, err, tt.err)
+		}
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	for _, tt := range []struct {
+		enc  *Encoding
+		n    int
+		want int
+	}{
+		// Japanese hiragana has 3 bytes per character in utf-8.
+		// So we need 3 times larger buffer than the standard base64.
+		{RawStdEncoding, 0, 0},
+		{RawStdEncoding, 1, 2 * 3},
+		{RawStdEncoding, 2, 3 * 3},
+		{RawStdEncoding, 3, 4 * 3},
+		{RawStdEncoding, 7, 10 * 3},
+
+		// We need 3 times larger buffer than the standard base64.
+		{StdEncoding, 0, 0},
+		{StdEncoding, 1, 4 * 3},
+		{StdEncoding, 2, 4 * 3},
+		{StdEncoding, 3, 4 * 3},
+		{StdEncoding, 4, 8 * 3},
+		{StdEncoding, 7, 12 * 3},
+
+		// Half-width katakana also has 3 bytes per character in utf-8.
+		{RawHankakuKatakanaEncoding, 1, 2 * 3},
+		{RawHankakuKatakanaEncoding, 7, 10 * 3},
+		{HankakuKatakanaEncoding, 1, 4 * 3},
+		{HankakuKatakanaEncoding, 7, 12 * 3},
+
+		// The URL safe alphabet also has 3 bytes per character in utf-8.
+		{URLEncoding, 1, 4 * 3},
+		{URLEncoding, 7, 12 * 3},
+		{RawURLEncoding, 7, 10 * 3},
+
+		// Emoji has 4 bytes per character in utf-8.
+		// We need larger buffer than Japanese hiragana.
+		{emojiEncode, 0, 0},
+		{emojiEncode, 1, 4 * 4},
+		{emojiEncode, 2, 4 * 4},
+		{emojiEncode, 3, 4 * 4},
+		{emojiEncode, 4, 8 * 4},
+		{emojiEncode, 7, 12 * 4},
+	} {
+		if got := tt.enc.EncodedLen(tt.n); got != tt.want {
+			t.Errorf("EncodedLen(%d): got %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestEncodedLenExact(t *testing.T) {
+	for _, enc := range []*Encoding{
+		StdEncoding, RawStdEncoding, HankakuKatakanaEncoding,
+		StdEncoding.WithPadding('='),
+	} {
+		for n := 0; n < 10; n++ {
+			src := []byte(strings.Repeat("\xff", n))
+			want := len(enc.EncodeToString(src))
+			if got := enc.EncodedLenExact(src); got != want {
+				t.Errorf("EncodedLenExact(%d bytes) = %d, want %d", n, got, want)
+			}
+		}
+	}
+
+	// the alphabet has runes of different lengths.
+	mixed := NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+あ")
+	for n := 0; n < 10; n++ {
+		src := []byte(strings.Repeat("\xff", n))
+		if got, want := mixed.EncodedLenExact(src), mixed.EncodedLen(n); got != want {
+			t.Errorf("EncodedLenExact(%d bytes) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestEncodedRuneLen(t *testing.T) {
+	for _, enc := range []*Encoding{
+		StdEncoding, RawStdEncoding, HankakuKatakanaEncoding, EmojiEncoding,
+		StdEncoding.WithPadding('='), StdEncoding.WithChecksum(xorSum),
+		NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+あ"),
+	} {
+		for n := 0; n < 10; n++ {
+			src := []byte(strings.Repeat("\xff", n))
+			want := utf8.RuneCountInString(enc.EncodeToString(src))
+			if got := enc.EncodedRuneLen(n); got != want {
+				t.Errorf("%v: EncodedRuneLen(%d) = %d, want %d", enc, n, got, want)
+			}
+		}
+	}
+
+	// 15 bytes are encoded into 20 characters.
+	if got := StdEncoding.EncodedRuneLen(15); got != 20 {
+		t.Errorf("EncodedRuneLen(15) = %d, want 20", got)
+	}
+}
+
+func TestDecodedLenString(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			encoded := tt.conv(p.encoded)
+			if got := tt.enc.DecodedLenString(encoded); got != len(p.decoded) {
+				t.Errorf("DecodedLenString(%q) = %d, want %d", encoded, got, len(p.decoded))
+			}
+			if upper := tt.enc.DecodedLen(len(encoded)); upper < len(p.decoded) {
+				t.Errorf("DecodedLen(%d) = %d, want >= %d", len(encoded), upper, len(p.decoded))
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			encoded := tt.conv(p.encoded)
+			decoded, err := tt.enc.DecodeString(encoded)
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", p.encoded, err)
+			}
+			if string(decoded) != string(p.decoded) {
+				t.Errorf("Decode(%q) = %q, want %q", p.encoded, decoded, p.decoded)
+			}
+		}
+	}
+
+	// test compatibility with standard base64
+	for _, p := range pairs {
+		decoded, err := StdEncoding.DecodeString(p.encoded)
+		if err != nil {
+			t.Errorf("Decode(%q) = %v", p.encoded, err)
+		}
+		decoded2, err := base64.StdEncoding.DecodeString(dq2std.Replace(p.encoded))
+		if err != nil {
+			t.Errorf("Decode(%q) = %v", p.encoded, err)
+		}
+		if string(decoded) != string(decoded2) {
+			t.Errorf("Decode(%q) = %q, want %q", p.encoded, decoded, decoded2)
+		}
+	}
+
+	// DecodeString allocates only the decoded data, even if the encoding may decode in constant time.
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := StdEncoding.DecodeString(bigtest.encoded); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 1 {
+		t.Errorf("DecodeString allocates %v times, want 1", allocs)
+	}
+}
+
+func TestAppendDecode(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			prefix := []byte("prefix:")
+			got, err := tt.enc.AppendDecode(prefix, []byte(tt.conv(p.encoded)))
+			if err != nil {
+				t.Errorf("AppendDecode(%q) = %v", p.encoded, err)
+			}
+			want := "prefix:" + p.decoded
+			if string(got) != want {
+				t.Errorf("AppendDecode(%q) = %q, want %q", p.encoded, got, want)
+			}
+		}
+	}
+
+	// dst must be left untouched on error.
+	prefix := []byte("prefix:")
+	got, err := StdEncoding.AppendDecode(prefix, []byte("ああ・あ"))
+	if errOffset(err) != len("ああ") {
+		t.Errorf("AppendDecode error = %v, want CorruptInputError(%d)", err, len("ああ"))
+	}
+	if string(got) != "prefix:" {
+		t.Errorf("AppendDecode = %q, want %q", got, "prefix:")
+	}
+}
+
+func TestEncodeWriter(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			w := &writeRecorder{}
+			n, err := tt.enc.EncodeWriter(w, []byte(p.decoded))
+			if err != nil {
+				t.Errorf("EncodeWriter(%q) = %v", p.decoded, err)
+			}
+			want := tt.conv(p.encoded)
+			if w.String() != want {
+				t.Errorf("EncodeWriter(%q) = %q, want %q", p.decoded, w.String(), want)
+			}
+			if n != len(want) {
+				t.Errorf("EncodeWriter(%q) returns %d, want %d", p.decoded, n, len(want))
+			}
+			if len(w.sizes) != 1 {
+				t.Errorf("EncodeWriter(%q) calls Write %d times, want 1", p.decoded, len(w.sizes))
+			}
+		}
+	}
+
+	errWrite := errors.New("write error")
+	if _, err := StdEncoding.EncodeWriter(errWriter{errWrite}, []byte("foo")); !errors.Is(err, errWrite) {
+		t.Errorf("want %v, got %v", errWrite, err)
+	}
+}
+
+// errWriter is an io.Writer that always fails with err.
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestEncodeToFixedString(t *testing.T) {
+	for _, tt := range []struct {
+		enc     *Encoding
+		src     string
+		runeLen int
+		want    string
+	}{
+		{StdEncoding, "foo", 4, "はらぶげ"},
+		{StdEncoding, "foo", 6, "はらぶげ・・"},
+		{StdEncoding, "f", 5, "はむ・・・"},
+		{StdEncoding, "", 2, "・・"},
+		{HankakuKatakanaEncoding, "f", 6, "ﾊﾑ････"},
+		{RawStdEncoding, "f", 2, "はむ"},
+		{StdEncoding, "\x10\xaf\x91\x55\x97\x6b\xbe\xfd\xba\xf8\x21\x8a\x38\xa5\x59", 20, "おさべつにはほわげげだどべうきさそさには"},
+	} {
+		got, err := tt.enc.EncodeToFixedString([]byte(tt.src), tt.runeLen)
+		if err != nil {
+			t.Errorf("EncodeToFixedString(%q, %d) = %v", tt.src, tt.runeLen, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("EncodeToFixedString(%q, %d) = %q, want %q", tt.src, tt.runeLen, got, tt.want)
+		}
+	}
+
+	if _, err := StdEncoding.EncodeToFixedString([]byte("foo"), 3); err == nil {
+		t.Error("want error for too long output, got nil")
+	}
+	if _, err := RawStdEncoding.EncodeToFixedString([]byte("f"), 4); err == nil {
+		t.Error("want error for no padding, got nil")
+	}
+}
+
+func TestDecodeWriter(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			encoded := tt.conv(p.encoded)
+			w := &strings.Builder{}
+			n, err := tt.enc.DecodeWriter(w, encoded)
+			if err != nil {
+				t.Errorf("DecodeWriter(%q) = %v", encoded, err)
+			}
+			if w.String() != p.decoded {
+				t.Errorf("DecodeWriter(%q) = %q, want %q", encoded, w.String(), p.decoded)
+			}
+			if n != len(p.decoded) {
+				t.Errorf("DecodeWriter(%q) returns %d, want %d", encoded, n, len(p.decoded))
+			}
+		}
+	}
+
+	// large input is written in chunks.
+	w := &writeRecorder{}
+	if _, err := StdEncoding.DecodeWriter(w, bigtest.encoded); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != bigtest.decoded {
+		t.Errorf("DecodeWriter(%q) = %q, want %q", bigtest.encoded, w.String(), bigtest.decoded)
+	}
+
+	// large input is written in chunks while decoding.
+	data := strings.Repeat("\x10\xaf\x91\x55\x97\x6b\xbe\xfd\xba\xf8\x21\x8a\x38\xa5\x59", 100)
+	encoded := StdEncoding.EncodeToString([]byte(data))
+	w = &writeRecorder{}
+	n, err := StdEncoding.DecodeWriter(w, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) || w.String() != data {
+		t.Errorf("DecodeWriter(%q) = %d, %q, want %q", encoded, n, w.String(), data)
+	}
+	if len(w.sizes) < 2 {
+		t.Errorf("DecodeWriter writes %v, want several chunks", w.sizes)
+	}
+
+	// the writing stops at the error.
+	w = &writeRecorder{}
+	n, err = StdEncoding.DecodeWriter(w, encoded+"！")
+	if !errors.Is(err, ErrInvalidRune) || errOffset(err) != len(encoded) {
+		t.Errorf("want %v at %d, got %v", ErrInvalidRune, len(encoded), err)
+	}
+	if n != len(w.String()) || !strings.HasPrefix(data, w.String()) || n == len(data) {
+		t.Errorf("DecodeWriter returns %d and writes %d bytes for invalid input", n, len(w.String()))
+	}
+
+	// nothing is written for invalid input shorter than a chunk.
+	w = &writeRecorder{}
+	n, err = StdEncoding.DecodeWriter(w, bigtest.encoded+"！")
+	if !errors.Is(err, ErrTrailingGarbage) {
+		t.Errorf("want %v, got %v", ErrTrailingGarbage, err)
+	}
+	if n != 0 || len(w.sizes) != 0 {
+		t.Errorf("DecodeWriter writes %q for invalid input", w.String())
+	}
+
+	errWrite := errors.New("write error")
+	if _, err := StdEncoding.DecodeWriter(errWriter{errWrite}, "はらぶげ"); !errors.Is(err, errWrite) {
+		t.Errorf("want %v, got %v", errWrite, err)
+	}
+}
+
+func TestDecodeStringInto(t *testing.T) {
+	buf := make([]byte, 0, 64)
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			got, err := tt.enc.DecodeStringInto(buf, tt.conv(p.encoded))
+			if err != nil {
+				t.Errorf("DecodeStringInto(%q) = %v", p.encoded, err)
+			}
+			if string(got) != p.decoded {
+				t.Errorf("DecodeStringInto(%q) = %q, want %q", p.encoded, got, p.decoded)
+			}
+			if len(p.decoded) <= cap(buf) && &got[:1][0] != &buf[:1][0] {
+				t.Errorf("DecodeStringInto(%q) allocates a new slice", p.encoded)
+			}
+		}
+	}
+
+	// grow the buffer if the capacity is not enough.
+	got, err := StdEncoding.DecodeStringInto([]byte("foo"), bigtest.encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != bigtest.decoded {
+		t.Errorf("DecodeStringInto(%q) = %q, want %q", bigtest.encoded, got, bigtest.decoded)
+	}
+
+	_, err = StdEncoding.DecodeStringInto(buf, "ああ・あ")
+	if errOffset(err) != len("ああ") {
+		t.Errorf("DecodeStringInto error = %v, want CorruptInputError(%d)", err, len("ああ"))
+	}
+}
+
+func BenchmarkDecodeStringInto(b *testing.B) {
+	data := StdEncoding.EncodeToString(make([]byte, 8192))
+	buf := make([]byte, 0, 8192)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = StdEncoding.DecodeStringInto(buf, data)
+	}
+}
+
+var decodeCorruptTestCases = []struct {
+	input  string
+	offset int   // -1 means no corruption.
+	cause  error // the error wrapped by the corruption.
+}{
+	{"", -1, nil},
+	{"\n", -1, nil},
+	{"あああ・\n", -1, nil},
+	{"ああああ\n", -1, nil},
+	{"\xff", 0, ErrInvalidUTF8},
+	{"あ\xe3\x41", len("あ"), ErrInvalidUTF8},
+	{"あ\n\x81", len("あ\n"), ErrInvalidUTF8},
+	{"あ！", len("あ"), ErrInvalidRune},
+	{"！！！！", 0, ErrInvalidRune},
+	{"・・・・", 0, ErrBadPadding},
+	{"が・・・", len("が"), ErrBadPadding},
+	{"・あああ", 0, ErrBadPadding},
+	{"あ・ああ", len("あ"), ErrBadPadding},
+	{"ああ・あ", len("ああ"), ErrInvalidRune},
+	{"ああ・・あ", len("ああ・・"), ErrTrailingGarbage},
+	{"あああ・ああああ", len("あああ・"), ErrTrailingGarbage},
+	{"あああああ", len("ああああ"), ErrTruncated},
+	{"ああああああ", len("ああああ"), ErrTruncated},
+	{"あ・", len("あ"), ErrBadPadding},
+	{"あ・・", len("あ"), ErrBadPadding},
+	{"ああ・", len("ああ・"), ErrTruncated},
+	{"ああ・・", -1, nil},
+	{"あああ・", -1, nil},
+	{"ああああ", -1, nil},
+	{"ああああああ・", len("ああああああ・"), ErrTruncated},
+	{"ふるいけやか・・・・・", len("ふるいけやか・・"), ErrTrailingGarbage},
+	{"あ！\n", len("あ"), ErrInvalidRune},
+	{"あ・\n", len("あ"), ErrBadPadding},
+
+	// padding after a complete block is never required.
+	{"ああああ・", len("ああああ"), ErrBadPadding},
+	{"ああああ\n・・", len("ああああ"), ErrBadPadding},
+	{"ああああ・・・・", len("ああああ"), ErrBadPadding},
+	{"ああああああ・・・・", len("ああああああ・・"), ErrTrailingGarbage},
+}
+
+// errOffset returns the offset reported by err, or -1 if err is not a corruption.
+func errOffset(err error) int {
+	var cie CorruptInputError
+	if !errors.As(err, &cie) {
+		return -1
+	}
+	return int(cie)
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	for _, tc := range decodeCorruptTestCases {
+		dbuf := make([]byte, StdEncoding.DecodedLen(len(tc.input)))
+		_, err := StdEncoding.Decode(dbuf, []byte(tc.input))
+		if tc.offset == -1 {
+			if err != nil {
+				t.Error("Decoder wrongly detected corruption in", tc.input)
+			}
+			continue
+		}
+		if err == nil {
+			t.Error("Decoder failed to detect corruption in", tc)
+			continue
+		}
+		if offset := errOffset(err); offset != tc.offset {
+			t.Errorf("Decoder wrongly detected corruption in %q at offset %d, want %d", tc.input, offset, tc.offset)
+		}
+		if !errors.Is(err, tc.cause) {
+			t.Errorf("Decoder wrongly detected corruption in %q: %v, want %v", tc.input, err, tc.cause)
+		}
+	}
+}
+
+func TestDecodeInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		input  string
+		offset int
+		cause  error
+	}{
+		// invalid bytes
+		{"\xff", 0, ErrInvalidUTF8},
+		{"ああ\xc0\xaf", len("ああ"), ErrInvalidUTF8},
+		{"ああ\x80", len("ああ"), ErrInvalidUTF8},
+
+		// a sequence interrupted by another rune
+		{"ああ\xe3\x81あ", len("ああ"), ErrInvalidUTF8},
+		{"ああ\xe3\n", len("ああ"), ErrInvalidUTF8},
+
+		// overlong encoding of "\n"
+		{"ああ\xc0\x8a", len("ああ"), ErrInvalidUTF8},
+
+		// the offset is of the malformed sequence, not of the last rune.
+		{"ああ\r\n\xff", len("ああ\r\n"), ErrInvalidUTF8},
+		{"ああ・\xff", len("ああ・"), ErrInvalidUTF8},
+
+		// valid runes that are not in the alphabet
+		{"ああ！", len("ああ"), ErrInvalidRune},
+		{"ああ\r\n！", len("ああ"), ErrInvalidRune},
+		{"ああ\uFFFD", len("ああ"), ErrInvalidRune},
+
+		// the input ends in the middle of a rune
+		{"ああ\xe3\x81", len("ああ"), ErrInvalidUTF8},
+	}
+	for _, tt := range tests {
+		for name, decode := range map[string]func() error{
+			"Decode": func() error {
+				_, err := StdEncoding.DecodeString(tt.input)
+				return err
+			},
+			"DecodeRunewise": func() error {
+				_, err := StdEncoding.DecodeRunewise(make([]byte, len(tt.input)), []byte(tt.input))
+				return err
+			},
+			"ConstantTime": func() error {
+				_, err := StdEncoding.WithConstantTime().DecodeString(tt.input)
+				return err
+			},
+			"Decoder": func() error {
+				_, err := io.ReadAll(NewDecoder(StdEncoding, strings.NewReader(tt.input)))
+				return err
+			},
+			"OneByteReader": func() error {
+				_, err := io.ReadAll(NewDecoder(StdEncoding, iotest.OneByteReader(strings.NewReader(tt.input))))
+				return err
+			},
+		} {
+			err := decode()
+			if offset := errOffset(err); offset != tt.offset || !errors.Is(err, tt.cause) {
+				t.Errorf("%s(%q) = %v, want %v at offset %d", name, tt.input, err, tt.cause, tt.offset)
+			}
+		}
+	}
+}
+
+func TestDecodeDegeneratePadding(t *testing.T) {
+	tests := []struct {
+		input  string
+		offset int
+		cause  error
+	}{
+		// padding at the start
+		{"・", 0, ErrBadPadding},
+		{"・・", 0, ErrBadPadding},
+		{"・・・・", 0, ErrBadPadding},
+		{"\n・・", 0, ErrBadPadding},
+
+		// a block of padding after a complete block
+		{"ああああ・・", len("ああああ"), ErrBadPadding},
+		{"ああああ\n・・", len("ああああ"), ErrBadPadding},
+		{"ああああ・・・・", len("ああああ"), ErrBadPadding},
+		{"ああああ・・ああ", len("ああああ"), ErrBadPadding},
+
+		// extra padding after the padded final block
+		{"ああ・・・", len("ああ・・"), ErrTrailingGarbage},
+		{"ああ・・・・", len("ああ・・"), ErrTrailingGarbage},
+		{"あああ・・", len("あああ・"), ErrTrailingGarbage},
+		{"ああ・・\n・・", len("ああ・・\n"), ErrTrailingGarbage},
+
+		// the truncated rune is reported before the incomplete block
+		{"あ\xe3\x81", len("あ"), ErrInvalidUTF8},
+		{"ああ・\xe3\x83", len("ああ・"), ErrInvalidUTF8},
+	}
+	for _, tt := range tests {
+		for name, decode := range map[string]func() error{
+			"Decode": func() error {
+				_, err := StdEncoding.DecodeString(tt.input)
+				return err
+			},
+			"DecodeRunewise": func() error {
+				_, err := StdEncoding.DecodeRunewise(make([]byte, len(tt.input)), []byte(tt.input))
+				return err
+			},
+			"Decoder": func() error {
+				_, err := io.ReadAll(NewDecoder(StdEncoding, strings.NewReader(tt.input)))
+				return err
+			},
+			"OneByteReader": func() error {
+				_, err := io.ReadAll(NewDecoder(StdEncoding, iotest.OneByteReader(strings.NewReader(tt.input))))
+				return err
+			},
+		} {
+			err := decode()
+			if offset := errOffset(err); offset != tt.offset || !errors.Is(err, tt.cause) {
+				t.Errorf("%s(%q) = %v, want %v at offset %d", name, tt.input, err, tt.cause, tt.offset)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			encoded := tt.conv(p.encoded)
+			if err := tt.enc.Validate(encoded); err != nil {
+				t.Errorf("Validate(%q) = %v", encoded, err)
+			}
+		}
+	}
+	for _, tc := range decodeCorruptTestCases {
+		_, want := StdEncoding.DecodeString(tc.input)
+		got := StdEncoding.Validate(tc.input)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Validate(%q) = %v, want %v", tc.input, got, want)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := StdEncoding.Validate(bigtest.encoded); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Validate allocates %v times, want 0", allocs)
+	}
+}
+
+func TestDecodedCount(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			encoded := tt.conv(p.encoded)
+			n, err := tt.enc.DecodedCount(encoded)
+			if err != nil {
+				t.Errorf("DecodedCount(%q) = %v", encoded, err)
+			}
+			if n != len(p.decoded) {
+				t.Errorf("DecodedCount(%q) = %d, want %d", encoded, n, len(p.decoded))
+			}
+		}
+	}
+	for _, tc := range decodeCorruptTestCases {
+		decoded, want := StdEncoding.DecodeString(tc.input)
+		n, got := StdEncoding.DecodedCount(tc.input)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("DecodedCount(%q) = %v, want %v", tc.input, got, want)
+		}
+		if n != len(decoded) {
+			t.Errorf("DecodedCount(%q) = %d, want %d", tc.input, n, len(decoded))
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := StdEncoding.DecodedCount(bigtest.encoded); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("DecodedCount allocates %v times, want 0", allocs)
+	}
+}
+
+func TestDecodeConsumed(t *testing.T) {
+	for _, tt := range []struct {
+		enc   *Encoding
+		input string
+		want  string
+		nSrc  int
+	}{
+		{StdEncoding, "はらぶげ", "foo", len("はらぶげ")},
+		{StdEncoding, "はらぶげ 以降", "foo", len("はらぶげ")},
+		{StdEncoding, "はらぶげのらか・。", "fooba", len("はらぶげのらか・")},
+		{StdEncoding, "はらぶげのらか・は", "fooba", len("はらぶげのらか・")},
+		{StdEncoding, "はらぶげのら!", "foo", len("はらぶげ")},
+		{StdEncoding, "はらぶげのら・!", "foo", len("はらぶげ")},
+		{StdEncoding, "はらぶげ\n\n!", "foo", len("はらぶげ")},
+		{StdEncoding, "はらぶげ\xe3", "foo", len("はらぶげ")},
+		{StdEncoding, "!", "", 0},
+		{RawStdEncoding, "はらぶげのらか!", "fooba", len("はらぶげのらか")},
+		{RawStdEncoding, "はらぶげの!", "foo", len("はらぶげ")},
+	} {
+		dst := make([]byte, tt.enc.DecodedLen(len(tt.input)))
+		nDst, nSrc, err := tt.enc.DecodeConsumed(dst, []byte(tt.input))
+		if err != nil {
+			t.Errorf("DecodeConsumed(%q) = %v", tt.input, err)
+			continue
+		}
+		if string(dst[:nDst]) != tt.want || nSrc != tt.nSrc {
+			t.Errorf("DecodeConsumed(%q) = %q, %d, want %q, %d", tt.input, dst[:nDst], nSrc, tt.want, tt.nSrc)
+		}
+	}
+
+	// errors in the consumed data are reported.
+	input := []byte("はらぶげのち!")
+	dst := make([]byte, 10)
+	if _, _, err := StdEncoding.Strict().DecodeConsumed(dst, []byte("はらぶげのめ・・!")); !errors.Is(err, ErrTrailingBits) {
+		t.Errorf("DecodeConsumed error = %v, want ErrTrailingBits", err)
+	}
+	if _, _, err := RawStdEncoding.DecodeConsumed(dst[:3], input); err != ErrShortBuffer {
+		t.Errorf("DecodeConsumed error = %v, want ErrShortBuffer", err)
+	}
+}
+
+func TestDecodePartial(t *testing.T) {
+	for _, tt := range []struct {
+		enc   *Encoding
+		input string
+		want  string
+		err   error
+	}{
+		{StdEncoding, "はらぶげのらか・", "fooba", nil},
+		{StdEncoding, "はらぶげのら!", "foo", ErrInvalidRune},
+		{StdEncoding, "はらぶげのらか・は", "fooba", ErrTrailingGarbage},
+		{StdEncoding, "はらぶげのら", "foo", ErrTruncated},
+		{StdEncoding, "はらぶげ\xe3\x81", "foo", ErrInvalidUTF8},
+		{StdEncoding, "は・", "", ErrBadPadding},
+		{StdEncoding.Strict(), "はらぶげのめ・・", "foo", ErrTrailingBits},
+		{RawStdEncoding, "はらぶげのらか!", "fooba", ErrInvalidRune},
+		{StdEncoding.WithKanaComposition(), "はらふ\u3099け\u3099のら!", "foo", ErrInvalidRune},
+		{StdEncoding.WithIgnoreInvalid(), "は!らぶ!げのら・", "foo", ErrTruncated},
+		{StdEncoding.WithChecksum(xorSum), "はらぶげのらか・!", "fooba", ErrTrailingGarbage},
+	} {
+		dst := make([]byte, tt.enc.DecodedLen(len(tt.input)))
+		n, err := tt.enc.DecodePartial(dst, []byte(tt.input))
+		if !errors.Is(err, tt.err) || (err != nil) != (tt.err != nil) {
+			t.Errorf("DecodePartial(%q) error = %v, want %v", tt.input, err, tt.err)
+		}
+		if string(dst[:n]) != tt.want {
+			t.Errorf("DecodePartial(%q) = %q, want %q", tt.input, dst[:n], tt.want)
+		}
+		var e CorruptInputError
+		if err != nil && !errors.As(err, &e) {
+			t.Errorf("DecodePartial(%q) error = %v, want CorruptInputError", tt.input, err)
+		}
+	}
+
+	dst := make([]byte, 2)
+	if n, err := StdEncoding.DecodePartial(dst, []byte("はらぶげ!")); n != 0 || err != ErrShortBuffer {
+		t.Errorf("DecodePartial into a short buffer = %d, %v, want 0, %v", n, err, ErrShortBuffer)
+	}
+}
+
+func TestDecodeN(t *testing.T) {
+	for _, tt := range []struct {
+		enc    *Encoding
+		input  string
+		nBytes int
+		want   string
+		nSrc   int
+	}{
+		{StdEncoding, "はらぶげのらか・", 0, "", 0},
+		{StdEncoding, "はらぶげのらか・", 3, "foo", len("はらぶげ")},
+		{StdEncoding, "はらぶげのらか・", 5, "fooba", len("はらぶげのらか・")},
+		{StdEncoding, "はらぶげ\nのらか・", 3, "foo", len("はらぶげ")},
+		{StdEncoding, "はらぶげ\nのら\nか\n・\n", 5, "fooba", len("はらぶげ\nのら\nか\n・")},
+		{StdEncoding, "はらぶげのらか・あいうえ", 5, "fooba", len("はらぶげのらか・")},
+		{StdEncoding, "はら・・はらぶげ", 1, "f", len("はら・・")},
+		{StdEncoding, "はらぶげ!", 3, "foo", len("はらぶげ")},
+		{StdEncoding, "\uFEFFはらぶげ", 3, "", 0},
+		{StdEncoding.WithSkipBOM(), "\uFEFFはらぶげのら", 3, "foo", len("\uFEFFはらぶげ")},
+		{RawStdEncoding, "はらぶげのらか", 5, "fooba", len("はらぶげのらか")},
+		{RawStdEncoding, "はらぶげのらかあいうえ", 5, "fooba", len("はらぶげのらか")},
+		{StdEncoding.WithKanaComposition(), "はらふ\u3099け\u3099のら", 3, "foo", len("はらふ\u3099け\u3099")},
+		{StdEncoding.WithIgnoreInvalid(), "は!らぶ!げ!のら", 3, "foo", len("は!らぶ!げ")},
+	} {
+		dst := make([]byte, tt.nBytes)
+		nSrc, err := tt.enc.DecodeN(dst, []byte(tt.input), tt.nBytes)
+		if tt.want == "" && tt.nBytes > 0 {
+			if !errors.Is(err, ErrInvalidRune) {
+				t.Errorf("DecodeN(%q, %d) error = %v, want ErrInvalidRune", tt.input, tt.nBytes, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("DecodeN(%q, %d) = %v", tt.input, tt.nBytes, err)
+			continue
+		}
+		if string(dst) != tt.want || nSrc != tt.nSrc {
+			t.Errorf("DecodeN(%q, %d) = %q, %d, want %q, %d", tt.input, tt.nBytes, dst, nSrc, tt.want, tt.nSrc)
+		}
+	}
+
+	for _, tt := range []struct {
+		enc    *Encoding
+		input  string
+		nBytes int
+		cause  error
+	}{
+		{StdEncoding, "はらぶ", 3, ErrTruncated},
+		{StdEncoding, "はらぶげ", 6, ErrTruncated},
+		{RawStdEncoding, "はらぶげのら", 5, ErrTruncated},
+		{StdEncoding, "はらぶげ", 1, ErrTruncated},
+		{StdEncoding, "は・", 1, ErrBadPadding},
+		{StdEncoding, "はら!", 3, ErrInvalidRune},
+		{StdEncoding.Strict(), "はめ・・", 1, ErrTrailingBits},
+	} {
+		dst := make([]byte, tt.nBytes)
+		if _, err := tt.enc.DecodeN(dst, []byte(tt.input), tt.nBytes); !errors.Is(err, tt.cause) {
+			t.Errorf("DecodeN(%q, %d) error = %v, want %v", tt.input, tt.nBytes, err, tt.cause)
+		}
+	}
+
+	// the checksum follows the data.
+	enc := StdEncoding.WithChecksum(xorSum)
+	input := []byte(enc.EncodeToString([]byte("foobar")) + "あいうえ")
+	dst := make([]byte, 7)
+	if nSrc, err := enc.DecodeN(dst, input, 6); err != nil || string(dst[:6]) != "foobar" || nSrc != len(input)-len("あいうえ") {
+		t.Errorf("DecodeN = %q, %d, %v, want %q, %d", dst[:6], nSrc, err, "foobar", len(input)-len("あいうえ"))
+	}
+}
+
+func TestDecodeShortBuffer(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			encoded := []byte(tt.conv(p.encoded))
+			for size := 0; size < len(p.decoded); size++ {
+				dbuf := make([]byte, size)
+				n, err := tt.enc.Decode(dbuf, encoded)
+				if err != ErrShortBuffer {
+					t.Errorf("Decode(%q) into %d bytes = %d, %v, want %v", encoded, size, n, err, ErrShortBuffer)
+				}
+			}
+			dbuf := make([]byte, len(p.decoded))
+			n, err := tt.enc.Decode(dbuf, encoded)
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", encoded, err)
+			}
+			if string(dbuf[:n]) != p.decoded {
+				t.Errorf("Decode(%q) = %q, want %q", encoded, dbuf[:n], p.decoded)
+			}
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	for _, p := range pairs {
+		decoder := NewDecoder(StdEncoding, strings.NewReader(p.encoded))
+		dbuf := make([]byte, StdEncoding.DecodedLen(len(p.encoded)))
+		count, err := decoder.Read(dbuf)
+		if err != nil && err != io.EOF {
+			t.Fatalf("Read from %q failed: %v", p.encoded, err)
+		}
+		if count != len(p.decoded) {
+			t.Errorf("Read from %q = length %v, want %v", p.encoded, count, len(p.decoded))
+		}
+		if string(dbuf[0:count]) != p.decoded {
+			t.Errorf("Decoding of %q = %q, want %q", p.encoded, string(dbuf[0:count]), p.decoded)
+		}
+		if err != io.EOF {
+			count, err = decoder.Read(dbuf)
+			if count != 0 {
+				t.Errorf("Read after EOF from %q = %d, want 0", p.encoded, count)
+			}
+		}
+		if err != io.EOF {
+			t.Errorf("Read from %q = %v, want %v", p.encoded, err, io.EOF)
+		}
+	}
+}
+
+func TestNewDecoderSize(t *testing.T) {
+	encs := map[string]*Encoding{
+		"std":      StdEncoding,
+		"compose":  StdEncoding.WithKanaComposition(),
+		"invalid":  StdEncoding.WithIgnoreInvalid(),
+		"hankaku":  HankakuKatakanaEncoding,
+		"raw-name": RawNameEncoding,
+
+		// the bytes held back may be longer than the runes of the alphabet.
+		"ascii-compose": NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/").WithPadding('=').WithKanaComposition(),
+	}
+	for name, enc := range encs {
+		input := enc.EncodeToString([]byte(bigtest.decoded))
+		if name == "compose" {
+			input = decompose(input)
+		}
+		for _, bufSize := range []int{-1, 0, 1, 16, 100, 8192} {
+			readers := map[string]io.Reader{
+				"Reader":        strings.NewReader(input),
+				"OneByteReader": iotest.OneByteReader(strings.NewReader(input)),
+			}
+			for rname, r := range readers {
+				decoded, err := io.ReadAll(NewDecoderSize(enc, r, bufSize))
+				if err != nil {
+					t.Errorf("%s/%d/%s: Decoder(%q) = %v", name, bufSize, rname, input, err)
+				}
+				if string(decoded) != bigtest.decoded {
+					t.Errorf("%s/%d/%s: Decoder(%q) = %q, want %q", name, bufSize, rname, input, decoded, bigtest.decoded)
+				}
+			}
+		}
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	decoder := NewDecoder(StdEncoding, strings.NewReader("ああ・あ")).(Decoder)
+
+	// make the decoder fail, and reset it.
+	if _, err := io.ReadAll(decoder); err == nil {
+		t.Fatal("want error, got nil")
+	}
+	for _, p := range pairs {
+		decoder.Reset(strings.NewReader(p.encoded))
+		decoded, err := io.ReadAll(decoder)
+		if err != nil {
+			t.Errorf("Read from %q failed: %v", p.encoded, err)
+		}
+		if string(decoded) != p.decoded {
+			t.Errorf("Decoding of %q = %q, want %q", p.encoded, decoded, p.decoded)
+		}
+	}
+}
+
+func TestDecoderInputOffset(t *testing.T) {
+	for _, p := range pairs {
+		for _, r := range []io.Reader{strings.NewReader(p.encoded), iotest.OneByteReader(strings.NewReader(p.encoded))} {
+			decoder := NewDecoder(StdEncoding, r).(Decoder)
+			if _, err := io.ReadAll(decoder); err != nil {
+				t.Fatal(err)
+			}
+			if got := decoder.InputOffset(); got != int64(len(p.encoded)) {
+				t.Errorf("InputOffset() after %q = %d, want %d", p.encoded, got, len(p.encoded))
+			}
+			decoder.Reset(strings.NewReader(""))
+			if got := decoder.InputOffset(); got != 0 {
+				t.Errorf("InputOffset() after Reset = %d, want 0", got)
+			}
+		}
+	}
+
+	// the offset counts the bytes removed before decoding.
+	for _, tc := range []struct {
+		enc   *Encoding
+		input string
+	}{
+		{StdEncoding.WithKanaComposition(), decompose(bigtest.encoded)},
+		{StdEncoding.WithIgnoreInvalid(), strings.Join(strings.Split(bigtest.encoded, ""), "!")},
+		{StdEncoding.WithKanaComposition().WithIgnoreInvalid(), strings.Join(strings.Split(decompose(bigtest.encoded), ""), "!")},
+	} {
+		for _, r := range []io.Reader{strings.NewReader(tc.input), iotest.OneByteReader(strings.NewReader(tc.input))} {
+			decoder := NewDecoder(tc.enc, r).(Decoder)
+			if _, err := io.ReadAll(decoder); err != nil {
+				t.Fatal(err)
+			}
+			if got := decoder.InputOffset(); got != int64(len(tc.input)) {
+				t.Errorf("%v: InputOffset() after %q = %d, want %d", tc.enc, tc.input, got, len(tc.input))
+			}
+		}
+	}
+
+	for _, tc := range decodeCorruptTestCases {
+		if tc.offset == -1 {
+			continue
+		}
+		// the wrapping decoders report the offset of the inner decoder.
+		decoder := NewDecoder(StdEncoding.WithChecksum(func([]byte) byte { return 0 }), strings.NewReader(tc.input)).(Decoder)
+		if _, err := io.ReadAll(decoder); err == nil {
+			t.Fatalf("Decoder failed to detect corruption in %q", tc.input)
+		}
+		if got := decoder.InputOffset(); got < int64(tc.offset) || got > int64(len(tc.input)) {
+			t.Errorf("InputOffset() after %q = %d, want between %d and %d", tc.input, got, tc.offset, len(tc.input))
+		}
+	}
+}
+
+func TestDecoderCorrupt(t *testing.T) {
+	for _, tc := range decodeCorruptTestCases {
+		decoder := NewDecoder(StdEncoding, strings.NewReader(tc.input))
+		_, err := io.ReadAll(decoder)
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Decoder wrongly detected corruption in %q: %v", tc.input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Error("Decoder failed to detect corruption in", tc)
+			continue
+		}
+		if offset := errOffset(err); offset != tc.offset {
+			t.Errorf("Decoder wrongly detected corruption in %q at offset %d, want %d", tc.input, offset, tc.offset)
+		}
+		if !errors.Is(err, tc.cause) {
+			t.Errorf("Decoder wrongly detected corruption in %q: %v, want %v", tc.input, err, tc.cause)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	for _, tc := range decodeCorruptTestCases {
+		if tc.offset == -1 {
+			continue
+		}
+		want := &DecodeError{
+			ByteOffset: tc.offset,
+			RuneIndex:  utf8.RuneCountInString(tc.input[:tc.offset]),
+			Rune:       -1,
+			Err:        tc.cause,
+		}
+		if tc.offset < len(tc.input) {
+			want.Rune, _ = utf8.DecodeRuneInString(tc.input[tc.offset:])
+		}
+
+		_, err := StdEncoding.DecodeString(tc.input)
+		var got *DecodeError
+		if !errors.As(err, &got) {
+			t.Errorf("Decode(%q) error = %v, want DecodeError", tc.input, err)
+		} else if *got != *want {
+			t.Errorf("Decode(%q) error = %#v, want %#v", tc.input, got, want)
+		}
+
+		_, err = io.ReadAll(NewDecoder(StdEncoding, iotest.OneByteReader(strings.NewReader(tc.input))))
+		if !errors.As(err, &got) {
+			t.Errorf("Decoder(%q) error = %v, want DecodeError", tc.input, err)
+		} else if *got != *want {
+			t.Errorf("Decoder(%q) error = %#v, want %#v", tc.input, got, want)
+		}
+	}
+
+	for _, tc := range []struct {
+		input string
+		want  string
+	}{
+		{"ああ・あ", "illegal base64dq data: rune '・' at position 2: invalid rune"},
+		{"あああああ", "illegal base64dq data: rune 'あ' at position 4: truncated input"},
+		{"ああ・", "illegal base64dq data: end of input at position 3: truncated input"},
+	} {
+		_, err := StdEncoding.DecodeString(tc.input)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("Decode(%q) error = %v, want %s", tc.input, err, tc.want)
+		}
+	}
+}
+
+func TestDecodeError_LongInput(t *testing.T) {
+	// the errors are detected after the decoder refills its buffer many times.
+	prefix := StdEncoding.EncodeToString(make([]byte, 3000))
+	for _, tc := range []struct {
+		input  string
+		offset int
+		cause  error
+	}{
+		{prefix + "ああ・あ", len(prefix) + len("ああ"), ErrInvalidRune},
+		{prefix + "あああああ", len(prefix) + len("ああああ"), ErrTruncated},
+		{prefix + "ああ\xffあ", len(prefix) + len("ああ"), ErrInvalidUTF8},
+	} {
+		want := &DecodeError{
+			ByteOffset: tc.offset,
+			RuneIndex:  utf8.RuneCountInString(tc.input[:tc.offset]),
+			Err:        tc.cause,
+		}
+		want.Rune, _ = utf8.DecodeRuneInString(tc.input[tc.offset:])
+
+		for _, r := range []io.Reader{strings.NewReader(tc.input), iotest.HalfReader(strings.NewReader(tc.input))} {
+			_, err := io.ReadAll(NewDecoder(StdEncoding, r))
+			var got *DecodeError
+			if !errors.As(err, &got) {
+				t.Errorf("Decoder error = %v, want DecodeError", err)
+			} else if *got != *want {
+				t.Errorf("Decoder error = %#v, want %#v", got, want)
+			}
+		}
+	}
+}
+
+func TestDecoderBuffering(t *testing.T) {
+	for bs := 1; bs <= 12; bs++ {
+		decoder := NewDecoder(StdEncoding, strings.NewReader(bigtest.encoded))
 		buf := make([]byte, len(bigtest.decoded)+12)
 		var total int
 		var n int
@@ -471,6 +2083,415 @@ func TestDecoderBuffering(t *testing.T) {
 	}
 }
 
+func TestDecoderGreedyRead(t *testing.T) {
+	for _, tt := range encodingTests {
+		encoded := tt.conv(bigtest.encoded)
+
+		// a large p is filled by a single Read from the data available.
+		decoder := NewDecoder(tt.enc, iotest.DataErrReader(strings.NewReader(encoded)))
+		buf := make([]byte, 1024)
+		n, err := decoder.Read(buf)
+		if err != nil && err != io.EOF {
+			t.Errorf("Read(%q) error: %v", encoded, err)
+		}
+		if string(buf[:n]) != bigtest.decoded {
+			t.Errorf("Read(%q) = %q, want %q", encoded, buf[:n], bigtest.decoded)
+		}
+		if n, err := decoder.Read(buf); n != 0 || err != io.EOF {
+			t.Errorf("Read after the end = %d, %v, want 0, EOF", n, err)
+		}
+		if got := decoder.(Decoder).InputOffset(); got != int64(len(encoded)) {
+			t.Errorf("InputOffset() = %d, want %d", got, len(encoded))
+		}
+
+		for name, r := range map[string]func() io.Reader{
+			"OneByteReader": func() io.Reader { return iotest.OneByteReader(strings.NewReader(encoded)) },
+			"HalfReader":    func() io.Reader { return iotest.HalfReader(strings.NewReader(encoded)) },
+			"DataErrReader": func() io.Reader { return iotest.DataErrReader(iotest.OneByteReader(strings.NewReader(encoded))) },
+		} {
+			// the leftovers are accounted correctly for any size of p.
+			for bs := 1; bs <= 12; bs++ {
+				decoder := NewDecoder(tt.enc, struct{ io.Reader }{r()})
+				var got []byte
+				var err error
+				for err == nil {
+					var n int
+					n, err = decoder.Read(buf[:bs])
+					if n > bs {
+						t.Fatalf("%s: Read returns %d bytes, more than %d", name, n, bs)
+					}
+					got = append(got, buf[:n]...)
+				}
+				if err != io.EOF || string(got) != bigtest.decoded {
+					t.Errorf("%s: Decoding/%d of %q = %q, %v, want %q", name, bs, encoded, got, err, bigtest.decoded)
+				}
+			}
+		}
+	}
+}
+
+func TestDecoderPartialInput(t *testing.T) {
+	// Read returns the decoded data without waiting for more input.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go io.WriteString(pw, "はらぶげ\n")
+
+	decoder := NewDecoder(StdEncoding, pr)
+	done := make(chan struct{})
+	var n int
+	var err error
+	buf := make([]byte, 1024)
+	go func() {
+		n, err = decoder.Read(buf)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Read blocks after decoding a block")
+	}
+	if err != nil || string(buf[:n]) != "foo" {
+		t.Errorf("Read = %q, %v, want %q", buf[:n], err, "foo")
+	}
+}
+
+func TestWithIgnoredRunes(t *testing.T) {
+	enc := StdEncoding.WithIgnoredRunes(' ', '\t', '\u3000')
+	for _, tc := range []struct {
+		input  string
+		output string
+		offset int // -1 means no corruption.
+	}{
+		{"おさべつに　はほわげげ\tだどべうき さそさには", "\x10\xaf\x91\x55\x97\x6b\xbe\xfd\xba\xf8\x21\x8a\x38\xa5\x59", -1},
+		{" はむ・・", "f", -1},
+		{"はむ・・　", "f", -1},
+		{"はむ・　・", "f", -1},
+		{"はら び・\n \t", "fo", -1},
+		{"はむ・・　あ", "", len("はむ・・　")},
+		{"はむ・・　！", "", len("はむ・・　")},
+		{"はむ　！", "", len("はむ")},
+		{"はむ・・\xe3\x80", "", len("はむ・・")},
+	} {
+		decoded, err := enc.DecodeString(tc.input)
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", tc.input, err)
+			}
+			if string(decoded) != tc.output {
+				t.Errorf("Decode(%q) = %q, want %q", tc.input, decoded, tc.output)
+			}
+		} else if errOffset(err) != tc.offset {
+			t.Errorf("Decode(%q) error = %v, want CorruptInputError(%d)", tc.input, err, tc.offset)
+		}
+
+		decoded, err = io.ReadAll(NewDecoder(enc, strings.NewReader(tc.input)))
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Decoder(%q) = %v", tc.input, err)
+			}
+			if string(decoded) != tc.output {
+				t.Errorf("Decoder(%q) = %q, want %q", tc.input, decoded, tc.output)
+			}
+		} else if errOffset(err) != tc.offset {
+			t.Errorf("Decoder(%q) error = %v, want CorruptInputError(%d)", tc.input, err, tc.offset)
+		}
+	}
+
+	// the original encoding doesn't ignore them.
+	if _, err := StdEncoding.DecodeString("はむ ・・"); err == nil {
+		t.Error("StdEncoding wrongly ignored a space")
+	}
+}
+
+func TestWithIgnoredRunes_Panic(t *testing.T) {
+	for _, r := range []rune{'あ', StdPadding, utf8.MaxRune + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithIgnoredRunes(%q) did not panic", r)
+				}
+			}()
+			StdEncoding.WithIgnoredRunes(r)
+		}()
+	}
+}
+
+func TestWithIgnoredFormatting(t *testing.T) {
+	enc := StdEncoding.WithIgnoredFormatting()
+	for _, input := range []string{
+		"はらぶげ",
+		"\u200Bはら\u200Dぶげ\u2060",
+		"\u202Aはらぶげ\u202C",
+		"\uFEFFは\u00ADら\u200E\u200Fぶげ",
+	} {
+		for name, decode := range map[string]func() ([]byte, error){
+			"Decode": func() ([]byte, error) {
+				return enc.DecodeString(input)
+			},
+			"Decoder": func() ([]byte, error) {
+				return io.ReadAll(NewDecoder(enc, iotest.OneByteReader(strings.NewReader(input))))
+			},
+		} {
+			got, err := decode()
+			if err != nil || string(got) != "foo" {
+				t.Errorf("%s(%q) = %q, %v, want %q", name, input, got, err, "foo")
+			}
+		}
+	}
+	if _, err := StdEncoding.DecodeString("は\u200Bらぶげ"); !errors.Is(err, ErrInvalidRune) {
+		t.Errorf("DecodeString error = %v, want ErrInvalidRune", err)
+	}
+
+	// the runes already accepted are left as they are.
+	enc = StdEncoding.WithIgnoredRunes('\u200B').WithAliases(map[rune]rune{'\u200C': 'あ'}).WithIgnoredFormatting()
+	if got, err := enc.DecodeString("\u200C\u200C\u200C\u200C\u200B"); err != nil || string(got) != "\x00\x00\x00" {
+		t.Errorf("DecodeString = %q, %v, want %q", got, err, "\x00\x00\x00")
+	}
+}
+
+func TestWithAliases(t *testing.T) {
+	enc := NameEncoding.WithAliases(map[rune]rune{
+		'0': '０', '1': '１', '2': '２', '3': '３', '4': '４',
+		'5': '５', '6': '６', '7': '７', '8': '８', '9': '９',
+	})
+	for _, tc := range []struct {
+		input  string
+		output string
+		offset int // -1 means no corruption.
+	}{
+		{"０１２３", "\x00\x10\x83", -1},
+		{"0123", "\x00\x10\x83", -1},
+		{"0１2３", "\x00\x10\x83", -1},
+		{"01・・", "\x00", -1},
+		{"01・0", "", len("01")},
+		{"01a", "", len("01")},
+	} {
+		decoded, err := enc.DecodeString(tc.input)
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", tc.input, err)
+			}
+			if string(decoded) != tc.output {
+				t.Errorf("Decode(%q) = %q, want %q", tc.input, decoded, tc.output)
+			}
+		} else if errOffset(err) != tc.offset {
+			t.Errorf("Decode(%q) error = %v, want CorruptInputError(%d)", tc.input, err, tc.offset)
+		}
+	}
+
+	// the encoder still emits the alphabet runes.
+	if got, want := enc.EncodeToString([]byte("\x00\x10\x83")), "０１２３"; got != want {
+		t.Errorf("Encode() = %q, want %q", got, want)
+	}
+}
+
+func TestWithAliases_Panic(t *testing.T) {
+	for _, aliases := range []map[rune]rune{
+		{'あ': 'い'},
+		{StdPadding: 'あ'},
+		{'\n': 'あ'},
+		{'a': 'A'},
+		{utf8.MaxRune + 1: 'あ'},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithAliases(%q) did not panic", aliases)
+				}
+			}()
+			StdEncoding.WithAliases(aliases)
+		}()
+	}
+}
+
+func TestWithCaseFolding(t *testing.T) {
+	// the alphabet contains only the upper case letters.
+	enc := NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&'()*+,-./:;<>?@[]^_{|}~").
+		WithPadding('=').
+		WithCaseFolding()
+	want := enc.EncodeToString([]byte("foobar"))
+	mixed := []byte(want)
+	for i := 0; i < len(mixed); i += 2 {
+		mixed[i] = strings.ToLower(string(mixed[i]))[0]
+	}
+	for _, input := range []string{want, strings.ToLower(want), string(mixed)} {
+		if got, err := enc.DecodeString(input); err != nil || string(got) != "foobar" {
+			t.Errorf("DecodeString(%q) = %q, %v, want %q", input, got, err, "foobar")
+		}
+		if got, err := io.ReadAll(NewDecoder(enc, iotest.OneByteReader(strings.NewReader(input)))); err != nil || string(got) != "foobar" {
+			t.Errorf("Decoder(%q) = %q, %v, want %q", input, got, err, "foobar")
+		}
+	}
+	// the runes other than ASCII letters are not folded.
+	if _, err := enc.DecodeString("ＺＨＨＶ"); !errors.Is(err, ErrInvalidRune) {
+		t.Errorf("DecodeString error = %v, want ErrInvalidRune", err)
+	}
+
+	// both cases are already in the standard base64 alphabet.
+	std := NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/").WithPadding('=')
+	if !std.WithCaseFolding().Equal(std) {
+		t.Error("WithCaseFolding changes the standard base64 alphabet")
+	}
+
+	// no-op for the alphabets without ASCII letters.
+	if !StdEncoding.WithCaseFolding().Equal(StdEncoding) {
+		t.Error("WithCaseFolding changes StdEncoding")
+	}
+}
+
+func TestStrictNoWhitespace(t *testing.T) {
+	enc := StdEncoding.StrictNoWhitespace()
+	for _, tc := range []struct {
+		input  string
+		output string
+		offset int   // -1 means no corruption.
+		cause  error // the error wrapped by the corruption.
+	}{
+		{"", "", -1, nil},
+		{"はらぶげのらお・", "fooba", -1, nil},
+		{"はらぶげ\nのらお・", "", len("はらぶげ"), ErrInvalidRune},
+		{"\r\nはらぶげ", "", 0, ErrInvalidRune},
+		{"はらぶげ\n", "", len("はらぶげ"), ErrInvalidRune},
+		{"はらぶげのらお・\n", "", len("はらぶげのらお・"), ErrTrailingGarbage},
+		{"はらぶげのむ・\n・", "", len("はらぶげのむ"), ErrInvalidRune},
+		{"はめ・・", "", len("はめ"), ErrTrailingBits},
+	} {
+		decoded, err := enc.DecodeString(tc.input)
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", tc.input, err)
+			}
+			if string(decoded) != tc.output {
+				t.Errorf("Decode(%q) = %q, want %q", tc.input, decoded, tc.output)
+			}
+		} else if errOffset(err) != tc.offset || !errors.Is(err, tc.cause) {
+			t.Errorf("Decode(%q) error = %v, want %v at %d", tc.input, err, tc.cause, tc.offset)
+		}
+
+		decoded, err = io.ReadAll(NewDecoder(enc, strings.NewReader(tc.input)))
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Decoder(%q) = %v", tc.input, err)
+			}
+			if string(decoded) != tc.output {
+				t.Errorf("Decoder(%q) = %q, want %q", tc.input, decoded, tc.output)
+			}
+		} else if errOffset(err) != tc.offset || !errors.Is(err, tc.cause) {
+			t.Errorf("Decoder(%q) error = %v, want %v at %d", tc.input, err, tc.cause, tc.offset)
+		}
+
+		dbuf := make([]byte, enc.DecodedLen(len(tc.input)))
+		n, err := enc.DecodeRunewise(dbuf, []byte(tc.input))
+		if tc.offset == -1 {
+			if err != nil || string(dbuf[:n]) != tc.output {
+				t.Errorf("DecodeRunewise(%q) = %q, %v, want %q", tc.input, dbuf[:n], err, tc.output)
+			}
+		} else if errOffset(err) != tc.offset || !errors.Is(err, tc.cause) {
+			t.Errorf("DecodeRunewise(%q) error = %v, want %v at %d", tc.input, err, tc.cause, tc.offset)
+		}
+	}
+
+	if enc.Equal(StdEncoding.Strict()) {
+		t.Error("StrictNoWhitespace is equal to Strict")
+	}
+}
+
+func TestWithDecodePadding(t *testing.T) {
+	enc := StdEncoding.WithDecodePadding('=', '＝')
+	for _, tc := range []struct {
+		enc    *Encoding
+		input  string
+		output string
+		offset int   // -1 means no corruption.
+		cause  error // the error wrapped by the corruption.
+	}{
+		{enc, "はらぶげのらか・", "fooba", -1, nil},
+		{enc, "はらぶげのらか=", "fooba", -1, nil},
+		{enc, "はらぶげのら＝＝", "foob", -1, nil},
+		{enc, "はらぶげのら・=", "foob", -1, nil},
+		{enc, "はらぶげのら=\n=", "foob", -1, nil},
+		{enc, "はらぶげの===", "", len("はらぶげの"), ErrBadPadding},
+		{enc, "はらぶげのら=＝あ", "", len("はらぶげのら=＝"), ErrTrailingGarbage},
+		{enc.Strict(), "はめ==", "", len("はめ"), ErrTrailingBits},
+		{enc.Strict(), "はめ＝・", "", len("はめ"), ErrTrailingBits},
+	} {
+		decoded, err := tc.enc.DecodeString(tc.input)
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", tc.input, err)
+			}
+			if string(decoded) != tc.output {
+				t.Errorf("Decode(%q) = %q, want %q", tc.input, decoded, tc.output)
+			}
+		} else if errOffset(err) != tc.offset || !errors.Is(err, tc.cause) {
+			t.Errorf("Decode(%q) error = %v, want %v at %d", tc.input, err, tc.cause, tc.offset)
+		}
+
+		decoded, err = io.ReadAll(NewDecoder(tc.enc, strings.NewReader(tc.input)))
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Decoder(%q) = %v", tc.input, err)
+			}
+			if string(decoded) != tc.output {
+				t.Errorf("Decoder(%q) = %q, want %q", tc.input, decoded, tc.output)
+			}
+		} else if errOffset(err) != tc.offset || !errors.Is(err, tc.cause) {
+			t.Errorf("Decoder(%q) error = %v, want %v at %d", tc.input, err, tc.cause, tc.offset)
+		}
+
+		dbuf := make([]byte, tc.enc.DecodedLen(len(tc.input)))
+		n, err := tc.enc.DecodeRunewise(dbuf, []byte(tc.input))
+		if tc.offset == -1 {
+			if err != nil || string(dbuf[:n]) != tc.output {
+				t.Errorf("DecodeRunewise(%q) = %q, %v, want %q", tc.input, dbuf[:n], err, tc.output)
+			}
+		} else if errOffset(err) != tc.offset || !errors.Is(err, tc.cause) {
+			t.Errorf("DecodeRunewise(%q) error = %v, want %v at %d", tc.input, err, tc.cause, tc.offset)
+		}
+	}
+
+	// the encoder still emits the canonical padding.
+	if got := enc.EncodeToString([]byte("foob")); got != "はらぶげのむ・・" {
+		t.Errorf("EncodeToString = %q, want %q", got, "はらぶげのむ・・")
+	}
+
+	if enc.Equal(StdEncoding) {
+		t.Error("WithDecodePadding is equal to the original")
+	}
+	if !enc.Equal(StdEncoding.WithDecodePadding('＝', '=')) {
+		t.Error("the order of the padding runes matters")
+	}
+	if e := enc.WithPadding('='); !e.Equal(StdEncoding.WithPadding('=').WithDecodePadding('＝')) {
+		t.Errorf("WithPadding('=') = %v", e)
+	}
+	if e := enc.WithPadding(NoPadding); !e.Equal(RawStdEncoding) {
+		t.Errorf("WithPadding(NoPadding) = %v", e)
+	}
+}
+
+func TestWithDecodePadding_Panic(t *testing.T) {
+	for _, tt := range []struct {
+		enc *Encoding
+		r   rune
+	}{
+		{StdEncoding, 'あ'},
+		{StdEncoding, StdPadding},
+		{StdEncoding, '\n'},
+		{StdEncoding, utf8.MaxRune + 1},
+		{StdEncoding.WithDecodePadding('='), '='},
+		{RawStdEncoding, '='},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithDecodePadding(%q) did not panic", tt.r)
+				}
+			}()
+			tt.enc.WithDecodePadding(tt.r)
+		}()
+	}
+}
+
 func BenchmarkEncodeToString(b *testing.B) {
 	data := make([]byte, 8192)
 	b.SetBytes(int64(len(data)))
@@ -479,6 +2500,28 @@ func BenchmarkEncodeToString(b *testing.B) {
 	}
 }
 
+func BenchmarkEncode_Short(b *testing.B) {
+	// the short messages end with the padding.
+	data := []byte("foob")
+	dst := make([]byte, StdEncoding.EncodedLen(len(data)))
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		StdEncoding.Encode(dst, data)
+	}
+}
+
+func BenchmarkEncodeToString_Generic(b *testing.B) {
+	// disable the fast path for the alphabets whose runes have the same length.
+	enc := StdEncoding.Clone()
+	enc.runeSize = 0
+
+	data := make([]byte, 8192)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		enc.EncodeToString(data)
+	}
+}
+
 func BenchmarkEncodeToString_Base64(b *testing.B) {
 	enc := NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/").WithPadding('=')
 	data := make([]byte, 8192)
@@ -497,6 +2540,13 @@ func BenchmarkEncodeToString_StdBase64(b *testing.B) {
 	}
 }
 
+func BenchmarkBuildDFA(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buildDFA(StdEncoding)
+	}
+}
+
 func BenchmarkDecodeString(b *testing.B) {
 	sizes := []int{2, 4, 8, 64, 8192}
 	benchFunc := func(b *testing.B, benchSize int) {
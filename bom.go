@@ -0,0 +1,29 @@
+package base64dq
+
+// bom is the byte order mark U+FEFF encoded in UTF-8.
+const bom = "\uFEFF"
+
+// WithSkipBOM creates a new encoding identical to enc except
+// that the decoder skips a UTF-8 byte order mark (U+FEFF) at the beginning of the input,
+// which some Windows tools write at the start of text files.
+// A byte order mark after the beginning is still an invalid rune.
+//
+// The offsets reported by DecodeError are relative to the input including the byte order mark.
+// The byte order mark must not be contained in the encoding's alphabet.
+func (enc *Encoding) WithSkipBOM() *Encoding {
+	if enc.contains('\uFEFF') {
+		panic("byte order mark contained in alphabet")
+	}
+	e := enc.Clone()
+	e.skipBOM = true
+	e.dfa = enc.dfa // the byte order mark never reaches the DFA.
+	return e
+}
+
+// bomLen returns the length of the byte order mark that the decoder skips at the beginning of src.
+func bomLen[T string | []byte](enc *Encoding, src T) int {
+	if enc.skipBOM && len(src) >= len(bom) && string(src[:len(bom)]) == bom {
+		return len(bom)
+	}
+	return 0
+}
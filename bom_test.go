@@ -0,0 +1,97 @@
+package base64dq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWithSkipBOM(t *testing.T) {
+	enc := StdEncoding.WithSkipBOM()
+	for _, tt := range []struct {
+		input  string
+		want   string
+		offset int // -1 means no corruption.
+		err    error
+	}{
+		{"", "", -1, nil},
+		{"\uFEFF", "", -1, nil},
+		{"\uFEFFはらぶげ", "foo", -1, nil},
+		{"\uFEFFはらぶげのらか・\n", "fooba", -1, nil},
+		{"\uFEFF\uFEFFはらぶげ", "", 3, ErrInvalidRune},
+		{"はら\uFEFFぶげ", "", 6, ErrInvalidRune},
+		{"\uFEFFはら!ぶげ", "", 9, ErrInvalidRune},
+		{"\uFEFFはらぶ", "", 3, ErrTruncated},
+	} {
+		decoders := map[string]func() ([]byte, error){
+			"Decode": func() ([]byte, error) {
+				return enc.DecodeString(tt.input)
+			},
+			"DecodeRunewise": func() ([]byte, error) {
+				dst := make([]byte, enc.DecodedLen(len(tt.input)))
+				n, err := enc.DecodeRunewise(dst, []byte(tt.input))
+				return dst[:n], err
+			},
+			"Decoder": func() ([]byte, error) {
+				return io.ReadAll(NewDecoder(enc, strings.NewReader(tt.input)))
+			},
+			"DecoderOneByte": func() ([]byte, error) {
+				return io.ReadAll(NewDecoder(enc, iotest.OneByteReader(strings.NewReader(tt.input))))
+			},
+		}
+		for name, decode := range decoders {
+			got, err := decode()
+			if tt.err == nil {
+				if err != nil || string(got) != tt.want {
+					t.Errorf("%s(%q) = %q, %v, want %q", name, tt.input, got, err, tt.want)
+				}
+				continue
+			}
+			var e *DecodeError
+			if !errors.As(err, &e) || e.Err != tt.err || e.ByteOffset != tt.offset {
+				t.Errorf("%s(%q) error = %v, want %v at %d", name, tt.input, err, tt.err, tt.offset)
+			}
+		}
+		if tt.err == nil {
+			if n := enc.DecodedLenString(tt.input); n != len(tt.want) {
+				t.Errorf("DecodedLenString(%q) = %d, want %d", tt.input, n, len(tt.want))
+			}
+		}
+	}
+
+	// the byte order mark is invalid by default.
+	_, err := StdEncoding.DecodeString("\uFEFFはらぶげ")
+	if !errors.Is(err, ErrInvalidRune) {
+		t.Errorf("DecodeString error = %v, want ErrInvalidRune", err)
+	}
+	if enc.Equal(StdEncoding) {
+		t.Error("WithSkipBOM is equal to the original encoding")
+	}
+}
+
+func TestWithSkipBOM_Transcode(t *testing.T) {
+	got, err := Transcode(StdEncoding, StdEncoding.WithSkipBOM(), "\uFEFFはらぶげ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\uFEFFはらぶげ"; got != want {
+		t.Errorf("Transcode = %q, want %q", got, want)
+	}
+}
+
+func TestWithSkipBOM_Panic(t *testing.T) {
+	alphabet := []rune(encodeStd)
+	alphabet[0] = '\uFEFF'
+	enc := NewEncodingFromRunes(alphabet)
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("WithSkipBOM doesn't panic")
+		} else if fmt.Sprint(r) != "byte order mark contained in alphabet" {
+			t.Errorf("unexpected panic: %v", r)
+		}
+	}()
+	enc.WithSkipBOM()
+}
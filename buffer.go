@@ -0,0 +1,28 @@
+package base64dq
+
+// Buffer is a reusable scratch buffer for encoding the data already in memory.
+// Reusing a Buffer across calls avoids allocating the intermediate buffer
+// that EncodeToString allocates on every call.
+// It is a lighter-weight alternative to the stream encoder.
+// The zero value is ready to use.
+// A Buffer must not be used by multiple goroutines at the same time.
+type Buffer struct {
+	buf []byte
+}
+
+// Encode encodes src using enc into the buffer, and returns the result.
+// The result is valid only until the next call of the Buffer's methods.
+// It doesn't allocate if the buffer is already large enough.
+func (b *Buffer) Encode(enc *Encoding, src []byte) []byte {
+	n := enc.EncodedLen(len(src))
+	if cap(b.buf) < n {
+		b.buf = make([]byte, n)
+	}
+	return b.buf[:enc.Encode(b.buf[:n], src)]
+}
+
+// EncodeString is like EncodeToString, but encodes src into the buffer.
+// Only the returned string is allocated.
+func (b *Buffer) EncodeString(enc *Encoding, src []byte) string {
+	return string(b.Encode(enc, src))
+}
@@ -0,0 +1,46 @@
+package base64dq
+
+import "testing"
+
+func TestBuffer(t *testing.T) {
+	var b Buffer
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			if got, want := b.EncodeString(tt.enc, []byte(p.decoded)), tt.conv(p.encoded); got != want {
+				t.Errorf("EncodeString(%q) = %q, want %q", p.decoded, got, want)
+			}
+			if got, want := string(b.Encode(tt.enc, []byte(p.decoded))), tt.conv(p.encoded); got != want {
+				t.Errorf("Encode(%q) = %q, want %q", p.decoded, got, want)
+			}
+		}
+	}
+
+	enc := StdEncoding.WithChecksum(xorSum)
+	if got, want := b.EncodeString(enc, []byte(bigtest.decoded)), enc.EncodeToString([]byte(bigtest.decoded)); got != want {
+		t.Errorf("EncodeString(%q) = %q, want %q", bigtest.decoded, got, want)
+	}
+
+	src := []byte(bigtest.decoded)
+	allocs := testing.AllocsPerRun(100, func() {
+		b.Encode(StdEncoding, src)
+	})
+	if allocs != 0 {
+		t.Errorf("Encode allocates %v times, want 0", allocs)
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		b.EncodeString(StdEncoding, src)
+	})
+	if allocs != 1 {
+		t.Errorf("EncodeString allocates %v times, want 1", allocs)
+	}
+}
+
+func BenchmarkBuffer(b *testing.B) {
+	var buf Buffer
+	data := []byte("foobar")
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		buf.EncodeString(StdEncoding, data)
+	}
+}
@@ -0,0 +1,152 @@
+package base64dq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrMissingChecksum is returned when the decoded data is too short to contain the checksum byte.
+var ErrMissingChecksum = errors.New("base64dq: missing checksum")
+
+// ChecksumError is returned when the checksum byte in the input
+// doesn't match the checksum of the decoded data.
+type ChecksumError struct {
+	Sum byte // checksum of the decoded data
+	Got byte // checksum byte in the input
+}
+
+// Error implements the error interface.
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("base64dq: checksum mismatch: got 0x%02x, want 0x%02x", e.Got, e.Sum)
+}
+
+// WithChecksum creates a new encoding identical to enc except
+// that the encoder appends the checksum byte sum(src) to the data before encoding,
+// and the decoder verifies and strips it after decoding.
+// The decoder returns a *ChecksumError if the checksum doesn't match,
+// or ErrMissingChecksum if the decoded data is empty.
+//
+// The checksum byte is encoded and decoded as a part of the data,
+// so the lengths, such as EncodedLen and DecodedLenString, include it,
+// and dst passed to Decode must have room for it.
+// The stream encoder and decoder keep all the data to compute the checksum,
+// and the stream decoder reports the mismatch at the end of the stream.
+//
+// Encodings with checksums are not Equal to other encodings, as functions are not comparable.
+func (enc *Encoding) WithChecksum(sum func([]byte) byte) *Encoding {
+	if sum == nil {
+		panic("nil checksum")
+	}
+	e := enc.Clone()
+	e.checksum = sum
+	e.dfa = enc.dfa // the checksum doesn't change the DFA.
+	return e
+}
+
+// withoutChecksum returns the encoding of the data with the checksum byte.
+func (enc *Encoding) withoutChecksum() *Encoding {
+	e := enc.Clone()
+	e.checksum = nil
+	e.dfa = enc.dfa
+	return e
+}
+
+// verifyChecksum verifies the checksum at the end of data,
+// and returns the length of the data without it.
+func (enc *Encoding) verifyChecksum(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, ErrMissingChecksum
+	}
+	n := len(data) - 1
+	if sum := enc.checksum(data[:n]); sum != data[n] {
+		return 0, &ChecksumError{Sum: sum, Got: data[n]}
+	}
+	return n, nil
+}
+
+// checksumEncoder appends the checksum of the written data on Close.
+type checksumEncoder struct {
+	e    Encoder
+	sum  func([]byte) byte
+	data []byte // data written so far
+}
+
+func (c *checksumEncoder) Write(p []byte) (int, error) {
+	n, err := c.e.Write(p)
+	c.data = append(c.data, p[:n]...)
+	return n, err
+}
+
+func (c *checksumEncoder) Close() error {
+	if _, err := c.e.Write([]byte{c.sum(c.data)}); err != nil {
+		return err
+	}
+	return c.e.Close()
+}
+
+func (c *checksumEncoder) Flush() error {
+	return c.e.Flush()
+}
+
+func (c *checksumEncoder) Reset(w io.Writer) {
+	c.e.Reset(w)
+	c.data = c.data[:0]
+}
+
+// checksumDecoder holds back the last decoded byte until the end of the stream,
+// and verifies it as the checksum.
+type checksumDecoder struct {
+	d       Decoder
+	enc     *Encoding
+	data    []byte // data returned so far
+	last    byte   // last byte read from d
+	hasLast bool   // whether last is valid
+	err     error
+}
+
+func (c *checksumDecoder) Read(p []byte) (n int, err error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for n == 0 && err == nil {
+		n, err = c.d.Read(p)
+		if n > 0 {
+			// return the last byte of the previous read, and hold back the last byte of this read.
+			last := p[n-1]
+			if c.hasLast {
+				copy(p[1:n], p[:n-1])
+				p[0] = c.last
+			} else {
+				n--
+			}
+			c.last, c.hasLast = last, true
+			c.data = append(c.data, p[:n]...)
+		}
+	}
+
+	if err == io.EOF {
+		if !c.hasLast {
+			err = ErrMissingChecksum
+		} else if _, verr := c.enc.verifyChecksum(append(c.data, c.last)); verr != nil {
+			err = verr
+		}
+	}
+	c.err = err
+	return n, err
+}
+
+func (c *checksumDecoder) InputOffset() int64 {
+	return c.d.InputOffset()
+}
+
+func (c *checksumDecoder) Reset(r io.Reader) {
+	c.d.Reset(r)
+	c.data = c.data[:0]
+	c.hasLast = false
+	c.err = nil
+}
@@ -0,0 +1,152 @@
+package base64dq
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func xorSum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum ^= b
+	}
+	return sum ^ 0x5a
+}
+
+func TestWithChecksum(t *testing.T) {
+	inputs := []string{"", "f", "fo", "foo", "foob", "fooba", "foobar", strings.Repeat("x", 1000)}
+	for _, base := range []*Encoding{StdEncoding, RawStdEncoding, StdEncoding.Strict(), RawStdEncoding.Strict(), StdEncoding.WithPadding('＝')} {
+		enc := base.WithChecksum(xorSum)
+		for _, input := range inputs {
+			encoded := enc.EncodeToString([]byte(input))
+			want := base.EncodeToString(append([]byte(input), xorSum([]byte(input))))
+			if encoded != want {
+				t.Errorf("EncodeToString(%q) = %q, want %q", input, encoded, want)
+			}
+			if got := enc.EncodedLen(len(input)); got != len(encoded) {
+				t.Errorf("EncodedLen(%d) = %d, want %d", len(input), got, len(encoded))
+			}
+			if got := enc.EncodedLenExact([]byte(input)); got != len(encoded) {
+				t.Errorf("EncodedLenExact(%q) = %d, want %d", input, got, len(encoded))
+			}
+
+			decoded, err := enc.DecodeString(encoded)
+			if err != nil {
+				t.Errorf("DecodeString(%q) = %v", encoded, err)
+				continue
+			}
+			if string(decoded) != input {
+				t.Errorf("DecodeString(%q) = %q, want %q", encoded, decoded, input)
+			}
+
+			dst := make([]byte, enc.DecodedLenString(encoded))
+			n, err := enc.DecodeRunewise(dst, []byte(encoded))
+			if err != nil || string(dst[:n]) != input {
+				t.Errorf("DecodeRunewise(%q) = %q, %v, want %q", encoded, dst[:n], err, input)
+			}
+			if err := enc.Validate(encoded); err != nil {
+				t.Errorf("Validate(%q) = %v", encoded, err)
+			}
+		}
+	}
+}
+
+func TestWithChecksum_Allocs(t *testing.T) {
+	enc := StdEncoding.WithChecksum(xorSum)
+	for _, input := range []string{"", "f", "fo", "foo", bigtest.decoded} {
+		src := []byte(input)
+		dst := make([]byte, enc.EncodedLen(len(src)))
+		allocs := testing.AllocsPerRun(100, func() {
+			enc.Encode(dst, src)
+		})
+		if allocs != 0 {
+			t.Errorf("Encode(%q) allocates %v times, want 0", input, allocs)
+		}
+	}
+}
+
+func TestWithChecksum_Mismatch(t *testing.T) {
+	enc := StdEncoding.WithChecksum(xorSum)
+	encoded := StdEncoding.EncodeToString([]byte("foo\x00"))
+
+	var cerr *ChecksumError
+	_, err := enc.DecodeString(encoded)
+	if !errors.As(err, &cerr) {
+		t.Fatalf("DecodeString(%q) error = %v, want *ChecksumError", encoded, err)
+	}
+	if want := xorSum([]byte("foo")); cerr.Sum != want || cerr.Got != 0 {
+		t.Errorf("ChecksumError = %+v, want Sum 0x%02x, Got 0x00", cerr, want)
+	}
+
+	dst := make([]byte, 4)
+	if _, err := enc.DecodeRunewise(dst, []byte(encoded)); !errors.As(err, &cerr) {
+		t.Errorf("DecodeRunewise(%q) error = %v, want *ChecksumError", encoded, err)
+	}
+	if err := enc.Validate(encoded); !errors.As(err, &cerr) {
+		t.Errorf("Validate(%q) error = %v, want *ChecksumError", encoded, err)
+	}
+	if _, err := enc.DecodeString(""); err != ErrMissingChecksum {
+		t.Errorf("DecodeString(\"\") error = %v, want ErrMissingChecksum", err)
+	}
+
+	// errors of the encoding are reported before the checksum.
+	if _, err := enc.DecodeString("はらぶ"); !errors.Is(err, ErrTruncated) {
+		t.Errorf("DecodeString(\"はらぶ\") error = %v, want ErrTruncated", err)
+	}
+}
+
+func TestWithChecksum_Stream(t *testing.T) {
+	enc := RawStdEncoding.WithChecksum(xorSum)
+	input := strings.Repeat("foobar", 500)
+
+	var buf bytes.Buffer
+	w := NewEncoder(enc, &buf)
+	for i := 0; i < len(input); i += 7 {
+		j := i + 7
+		if j > len(input) {
+			j = len(input)
+		}
+		if _, err := io.WriteString(w, input[i:j]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := enc.EncodeToString([]byte(input)); buf.String() != want {
+		t.Fatalf("encoder wrote %q, want %q", buf.String(), want)
+	}
+
+	got, err := io.ReadAll(iotest.OneByteReader(NewDecoder(enc, strings.NewReader(buf.String()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != input {
+		t.Errorf("decoder read %q, want %q", got, input)
+	}
+
+	// the mismatch is reported at the end of the stream.
+	bad := RawStdEncoding.EncodeToString([]byte("foobar\x00"))
+	_, err = io.ReadAll(NewDecoder(enc, strings.NewReader(bad)))
+	var cerr *ChecksumError
+	if !errors.As(err, &cerr) {
+		t.Errorf("decoder error = %v, want *ChecksumError", err)
+	}
+	_, err = io.ReadAll(NewDecoder(enc, strings.NewReader("")))
+	if err != ErrMissingChecksum {
+		t.Errorf("decoder error = %v, want ErrMissingChecksum", err)
+	}
+}
+
+func TestWithChecksum_Panic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithChecksum(nil) doesn't panic")
+		}
+	}()
+	StdEncoding.WithChecksum(nil)
+}
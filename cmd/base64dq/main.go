@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"runtime/debug"
+	"unicode/utf8"
 
 	"github.com/shogo82148/base64dq"
 )
@@ -15,31 +19,243 @@ func main() {
 
 func run() int {
 	var decode bool
+	var wrap int
+	var output string
+	var encName string
+	var alphabet string
+	var padding string
+	var noPad, strict bool
+	var ignoreGarbage bool
+	var showVersion bool
 	flag.BoolVar(&decode, "d", false, "decode data")
 	flag.BoolVar(&decode, "decode", false, "decode data")
+	flag.IntVar(&wrap, "w", 76, "wrap encoded lines after `COLS` runes. Use 0 to disable line wrapping")
+	flag.StringVar(&output, "o", "", "write the result to `PATH` instead of stdout")
+	flag.StringVar(&encName, "e", "std", "use the encoding `NAME`: std, name, katakana, hankaku-katakana, emoji, url, or their raw- variants")
+	flag.StringVar(&alphabet, "alphabet", "", "use the custom 64-rune `STRING` as the alphabet instead of -e")
+	flag.StringVar(&padding, "p", "", "use `RUNE` as the padding character")
+	flag.BoolVar(&noPad, "no-pad", false, "disable padding")
+	flag.BoolVar(&strict, "strict", false, "reject non-zero trailing bits in decoding")
+	flag.BoolVar(&ignoreGarbage, "i", false, "when decoding, ignore non-alphabet runes")
+	flag.BoolVar(&ignoreGarbage, "ignore-garbage", false, "when decoding, ignore non-alphabet runes")
+	flag.BoolVar(&showVersion, "version", false, "print the version and exit")
 	flag.Parse()
-	if decode {
-		return runDecode(os.Stdout, os.Stdin)
-	} else {
-		return runEncode(os.Stdout, os.Stdin)
+
+	if showVersion {
+		fmt.Println("base64dq", version())
+		return 0
+	}
+
+	enc, err := newEncoding(encName, alphabet)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	enc, err = configureEncoding(enc, padding, noPad, strict)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	r := newInputReader(os.Stdin, flag.Args())
+	defer r.Close()
+	if decode && ignoreGarbage {
+		enc = enc.WithIgnoreInvalid()
+	}
+	return runOutput(output, os.Stdout, func(w io.Writer) int {
+		if decode {
+			return runDecode(w, r, enc)
+		}
+		return runEncode(w, r, enc, wrap)
+	})
+}
+
+// createFile creates the output file. It is replaced in the tests.
+var createFile = func(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+// runOutput calls run with the file named output, or stdout if output is empty,
+// and returns its exit code.
+// The exit code is 1 if the file can't be created or closed.
+func runOutput(output string, stdout io.Writer, run func(w io.Writer) int) int {
+	if output == "" {
+		return run(stdout)
+	}
+	f, err := createFile(output)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	code := run(f)
+	if err := f.Close(); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return code
+}
+
+// version returns the module version of the command, or "devel" if it is unknown.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" || info.Main.Version == "(devel)" {
+		return "devel"
+	}
+	return info.Main.Version
+}
+
+var encodings = map[string]*base64dq.Encoding{
+	"std":                  base64dq.StdEncoding,
+	"name":                 base64dq.NameEncoding,
+	"katakana":             base64dq.KatakanaEncoding,
+	"hankaku-katakana":     base64dq.HankakuKatakanaEncoding,
+	"emoji":                base64dq.EmojiEncoding,
+	"url":                  base64dq.URLEncoding,
+	"raw-std":              base64dq.RawStdEncoding,
+	"raw-name":             base64dq.RawNameEncoding,
+	"raw-katakana":         base64dq.RawKatakanaEncoding,
+	"raw-hankaku-katakana": base64dq.RawHankakuKatakanaEncoding,
+	"raw-emoji":            base64dq.RawEmojiEncoding,
+	"raw-url":              base64dq.RawURLEncoding,
+}
+
+// lookupEncoding returns the predefined encoding named name.
+func lookupEncoding(name string) (*base64dq.Encoding, error) {
+	enc, ok := encodings[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding: %q", name)
+	}
+	return enc, nil
+}
+
+// newEncoding returns the encoding with the custom alphabet if it is not empty,
+// otherwise the predefined encoding named name.
+func newEncoding(name, alphabet string) (*base64dq.Encoding, error) {
+	if alphabet != "" {
+		return base64dq.NewEncodingErr(alphabet)
+	}
+	return lookupEncoding(name)
+}
+
+// configureEncoding applies the padding and strict mode options to enc.
+func configureEncoding(enc *base64dq.Encoding, padding string, noPad, strict bool) (*base64dq.Encoding, error) {
+	if padding != "" && noPad {
+		return nil, errors.New("-p and -no-pad are mutually exclusive")
+	}
+	if padding != "" {
+		r, size := utf8.DecodeRuneInString(padding)
+		if r == utf8.RuneError || size != len(padding) {
+			return nil, fmt.Errorf("invalid padding %q: must be a single rune", padding)
+		}
+		var err error
+		enc, err = enc.WithPaddingErr(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if noPad {
+		enc = enc.WithPadding(base64dq.NoPadding)
+	}
+	if strict {
+		enc = enc.Strict()
+	}
+	return enc, nil
+}
+
+// inputReader is the concatenation of the input files.
+// The file name "-" means stdin.
+type inputReader struct {
+	stdin io.Reader
+	names []string
+	cur   io.Reader
+}
+
+func newInputReader(stdin io.Reader, names []string) *inputReader {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	return &inputReader{stdin: stdin, names: names}
+}
+
+func (r *inputReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.names) == 0 {
+				return 0, io.EOF
+			}
+			name := r.names[0]
+			r.names = r.names[1:]
+			if name == "-" {
+				r.cur = r.stdin
+			} else {
+				// the error from os.Open and (*os.File).Read contains the file name.
+				f, err := os.Open(name)
+				if err != nil {
+					return 0, err
+				}
+				r.cur = f
+			}
+		}
+
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.Close()
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes the current file.
+func (r *inputReader) Close() error {
+	var err error
+	if f, ok := r.cur.(*os.File); ok && r.cur != r.stdin {
+		err = f.Close()
 	}
+	r.cur = nil
+	return err
 }
 
-func runEncode(w io.Writer, r io.Reader) int {
-	enc := base64dq.NewEncoder(base64dq.StdEncoding, w)
-	if _, err := io.Copy(enc, r); err != nil {
+func runEncode(w io.Writer, r io.Reader, enc *base64dq.Encoding, wrap int) int {
+	cw := &countWriter{w: w}
+	e := base64dq.NewEncoderWithWrap(enc, cw, wrap, "\n")
+	if _, err := io.Copy(e, r); err != nil {
 		log.Println(err)
 		return 1
 	}
-	if err := enc.Close(); err != nil {
+	if err := e.Close(); err != nil {
 		log.Println(err)
 		return 1
 	}
+
+	// end the output with a newline as GNU base64 does,
+	// and write nothing for the empty input.
+	if cw.n > 0 {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			log.Println(err)
+			return 1
+		}
+	}
 	return 0
 }
 
-func runDecode(w io.Writer, r io.Reader) int {
-	dec := base64dq.NewDecoder(base64dq.StdEncoding, r)
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func runDecode(w io.Writer, r io.Reader, enc *base64dq.Encoding) int {
+	dec := base64dq.NewDecoder(enc, r)
 	if _, err := io.Copy(w, dec); err != nil {
 		log.Println(err)
 		return 1
@@ -2,26 +2,56 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/shogo82148/base64dq"
 )
 
 func TestRunEncode(t *testing.T) {
 	r := strings.NewReader("Hello, 世界")
 	w := new(bytes.Buffer)
-	code := runEncode(w, r)
+	code := runEncode(w, r, base64dq.StdEncoding, 76)
+	if code != 0 {
+		t.Error("code != 0")
+	}
+	if w.String() != "てきにがふきびがけそてづよぐまにやあ・・\n" {
+		t.Errorf("unexpected output: %q", w.String())
+	}
+}
+
+func TestRunEncode_Wrap(t *testing.T) {
+	r := strings.NewReader("Hello, 世界")
+	w := new(bytes.Buffer)
+	code := runEncode(w, r, base64dq.StdEncoding, 8)
+	if code != 0 {
+		t.Error("code != 0")
+	}
+	if w.String() != "てきにがふきびが\nけそてづよぐまに\nやあ・・\n" {
+		t.Errorf("unexpected output: %q", w.String())
+	}
+}
+
+func TestRunEncode_Empty(t *testing.T) {
+	r := strings.NewReader("")
+	w := new(bytes.Buffer)
+	code := runEncode(w, r, base64dq.StdEncoding, 76)
 	if code != 0 {
 		t.Error("code != 0")
 	}
-	if w.String() != "てきにがふきびがけそてづよぐまにやあ・・" {
-		t.Error("w.String() != `てきにがふきびがけそてづよぐまにやあ・・`")
+	if w.String() != "" {
+		t.Errorf("unexpected output: %q", w.String())
 	}
 }
 
 func TestRunDecode(t *testing.T) {
 	r := strings.NewReader("てきにがふきびがけそてづよぐまにやあ・・")
 	w := new(bytes.Buffer)
-	code := runDecode(w, r)
+	code := runDecode(w, r, base64dq.StdEncoding)
 	if code != 0 {
 		t.Error("code != 0")
 	}
@@ -29,3 +59,212 @@ func TestRunDecode(t *testing.T) {
 		t.Error("w.String() != `Hello, 世界`")
 	}
 }
+
+func TestInputReader(t *testing.T) {
+	dir := t.TempDir()
+	foo := filepath.Join(dir, "foo.txt")
+	bar := filepath.Join(dir, "bar.txt")
+	if err := os.WriteFile(foo, []byte("Hello, "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bar, []byte("世界"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{nil, "stdin"},
+		{[]string{"-"}, "stdin"},
+		{[]string{foo, bar}, "Hello, 世界"},
+		{[]string{foo, "-", bar}, "Hello, stdin世界"},
+	}
+	for _, tt := range tests {
+		r := newInputReader(strings.NewReader("stdin"), tt.names)
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.names, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestInputReader_NotFound(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "not-found.txt")
+	r := newInputReader(strings.NewReader(""), []string{name})
+	defer r.Close()
+	_, err := io.ReadAll(r)
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if !strings.Contains(err.Error(), name) {
+		t.Errorf("error %q does not contain the file name", err)
+	}
+	if code := runEncode(io.Discard, newInputReader(nil, []string{name}), base64dq.StdEncoding, 0); code != 1 {
+		t.Errorf("code = %d, want 1", code)
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.txt")
+	code := runOutput(name, io.Discard, func(w io.Writer) int {
+		return runEncode(w, strings.NewReader("Hello, 世界"), base64dq.StdEncoding, 76)
+	})
+	if code != 0 {
+		t.Errorf("code = %d, want 0", code)
+	}
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "てきにがふきびがけそてづよぐまにやあ・・\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+
+	// without -o, the result is written to stdout.
+	w := new(bytes.Buffer)
+	code = runOutput("", w, func(w io.Writer) int {
+		return runDecode(w, strings.NewReader("てきにがふきびがけそてづよぐまにやあ・・"), base64dq.StdEncoding)
+	})
+	if code != 0 || w.String() != "Hello, 世界" {
+		t.Errorf("code = %d, output = %q, want 0, %q", code, w.String(), "Hello, 世界")
+	}
+}
+
+func TestRunOutput_CreateError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "not-found", "out.txt")
+	called := false
+	code := runOutput(name, io.Discard, func(w io.Writer) int {
+		called = true
+		return 0
+	})
+	if code != 1 {
+		t.Errorf("code = %d, want 1", code)
+	}
+	if called {
+		t.Error("run is called though the file can't be created")
+	}
+}
+
+type errCloser struct {
+	bytes.Buffer
+}
+
+func (*errCloser) Close() error {
+	return errors.New("close error")
+}
+
+func TestRunOutput_CloseError(t *testing.T) {
+	defer func(f func(string) (io.WriteCloser, error)) { createFile = f }(createFile)
+	w := new(errCloser)
+	createFile = func(name string) (io.WriteCloser, error) {
+		return w, nil
+	}
+
+	code := runOutput("out.txt", io.Discard, func(w io.Writer) int {
+		return runEncode(w, strings.NewReader("Hello, 世界"), base64dq.StdEncoding, 76)
+	})
+	if code != 1 {
+		t.Errorf("code = %d, want 1", code)
+	}
+	if w.String() != "てきにがふきびがけそてづよぐまにやあ・・\n" {
+		t.Errorf("unexpected output: %q", w.String())
+	}
+}
+
+func TestLookupEncoding(t *testing.T) {
+	enc, err := lookupEncoding("raw-name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc != base64dq.RawNameEncoding {
+		t.Errorf("lookupEncoding(%q) = %v, want RawNameEncoding", "raw-name", enc)
+	}
+
+	if _, err := lookupEncoding("unknown"); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestNewEncoding(t *testing.T) {
+	enc, err := newEncoding("std", "アイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワガギグゲゴザジズゼゾダヂヅデドバビブベボ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enc.Equal(base64dq.KatakanaEncoding) {
+		t.Errorf("newEncoding returns %v, want KatakanaEncoding", enc)
+	}
+
+	if _, err := newEncoding("std", "あいうえお"); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestConfigureEncoding(t *testing.T) {
+	enc, err := configureEncoding(base64dq.StdEncoding, "=", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enc.Equal(base64dq.StdEncoding.WithPadding('=').Strict()) {
+		t.Errorf("unexpected encoding: %v", enc)
+	}
+
+	enc, err = configureEncoding(base64dq.StdEncoding, "", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enc.Equal(base64dq.RawStdEncoding) {
+		t.Errorf("unexpected encoding: %v", enc)
+	}
+
+	for _, tt := range []struct {
+		padding string
+		noPad   bool
+	}{
+		{"==", false},
+		{"\n", false},
+		{"=", true},
+	} {
+		if _, err := configureEncoding(base64dq.StdEncoding, tt.padding, tt.noPad, false); err == nil {
+			t.Errorf("configureEncoding(%q, %t): want error, got nil", tt.padding, tt.noPad)
+		}
+	}
+}
+
+func TestRunDecode_Strict(t *testing.T) {
+	// "はめ・・" has non-zero trailing bits.
+	w := new(bytes.Buffer)
+	if code := runDecode(w, strings.NewReader("はめ・・"), base64dq.StdEncoding.Strict()); code != 1 {
+		t.Errorf("code = %d, want 1", code)
+	}
+	w.Reset()
+	if code := runDecode(w, strings.NewReader("はめ・・"), base64dq.StdEncoding); code != 0 {
+		t.Errorf("code = %d, want 0", code)
+	}
+}
+
+func TestRunDecode_IgnoreGarbage(t *testing.T) {
+	input := "てきにがふきびが\nけそてづ!よぐまに\nやあ・・ (Hello, 世界)"
+	w := new(bytes.Buffer)
+	if code := runDecode(w, strings.NewReader(input), base64dq.StdEncoding); code != 1 {
+		t.Errorf("code = %d, want 1", code)
+	}
+	w.Reset()
+	if code := runDecode(w, strings.NewReader(input), base64dq.StdEncoding.WithIgnoreInvalid()); code != 0 {
+		t.Errorf("code = %d, want 0", code)
+	}
+	if w.String() != "Hello, 世界" {
+		t.Errorf("unexpected output: %q", w.String())
+	}
+}
+
+func TestVersion(t *testing.T) {
+	// the version depends on how the binary is built.
+	if v := version(); v == "" {
+		t.Error("version() is empty")
+	}
+}
@@ -0,0 +1,128 @@
+package base64dq
+
+import "unicode/utf8"
+
+const (
+	voicedMark     = '\u3099' // COMBINING KATAKANA-HIRAGANA VOICED SOUND MARK
+	semiVoicedMark = '\u309a' // COMBINING KATAKANA-HIRAGANA SEMI-VOICED SOUND MARK
+)
+
+// kana that can be combined with the voiced sound mark, and their precomposed forms.
+const (
+	voicedBase     = "うかきくけこさしすせそたちつてとはひふへほゝウカキクケコサシスセソタチツテトハヒフヘホワヰヱヲヽ"
+	voicedComposed = "ゔがぎぐげござじずぜぞだぢづでどばびぶべぼゞヴガギグゲゴザジズゼゾダヂヅデドバビブベボヷヸヹヺヾ"
+)
+
+// kana that can be combined with the semi-voiced sound mark, and their precomposed forms.
+const (
+	semiVoicedBase     = "はひふへほハヒフヘホ"
+	semiVoicedComposed = "ぱぴぷぺぽパピプペポ"
+)
+
+// composedKana maps a kana and a combining mark to the precomposed kana.
+var composedKana = map[[2]rune]rune{}
+
+// composableKana is the set of kana that can be composed with a combining mark.
+var composableKana = map[rune]struct{}{}
+
+func init() {
+	add := func(base, composed string, mark rune) {
+		c := []rune(composed)
+		for i, r := range []rune(base) {
+			composedKana[[2]rune{r, mark}] = c[i]
+			composableKana[r] = struct{}{}
+		}
+	}
+	add(voicedBase, voicedComposed, voicedMark)
+	add(semiVoicedBase, semiVoicedComposed, semiVoicedMark)
+}
+
+// WithKanaComposition creates a new encoding identical to enc except
+// that the decoder composes a kana followed by a combining voiced sound mark (U+3099)
+// or a combining semi-voiced sound mark (U+309A) into the precomposed kana,
+// as Unicode Normalization Form C (NFC) does.
+// For example, "か" followed by U+3099 is decoded as "が".
+//
+// The offsets reported by CorruptInputError are relative to the composed input.
+// The combining marks must not be contained in the encoding's alphabet.
+func (enc *Encoding) WithKanaComposition() *Encoding {
+	if enc.contains(voicedMark) || enc.contains(semiVoicedMark) {
+		panic("combining mark contained in alphabet")
+	}
+	e := enc.Clone()
+	e.compose = true
+	return e
+}
+
+// hasCombiningMark reports whether src contains the combining marks to be composed.
+func hasCombiningMark[T string | []byte](src T) bool {
+	// voicedMark and semiVoicedMark are encoded as "\xe3\x82\x99" and "\xe3\x82\x9a" in UTF-8.
+	for i := 2; i < len(src); i++ {
+		if src[i-2] == 0xe3 && src[i-1] == 0x82 && (src[i] == 0x99 || src[i] == 0x9a) {
+			return true
+		}
+	}
+	return false
+}
+
+// composeKana composes the kana followed by a combining mark in src.
+// It modifies src in place, and returns the composed slice.
+// Other bytes, including invalid UTF-8 sequences, are left as is.
+// The removed marks are recorded in removed.
+func composeKana(src []byte, removed *gaps) []byte {
+	var prev rune
+	prevPos := -1 // position of prev, or -1 if prev can't be composed
+	j := 0
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRune(src[i:])
+		if (r == voicedMark || r == semiVoicedMark) && prevPos >= 0 {
+			if c, ok := composedKana[[2]rune{prev, r}]; ok {
+				// the composed kana has the same length as the base kana.
+				utf8.EncodeRune(src[prevPos:], c)
+				removed.add(j, size)
+				prevPos = -1
+				i += size
+				continue
+			}
+		}
+		copy(src[j:], src[i:i+size])
+		prev, prevPos = r, j
+		i += size
+		j += size
+	}
+	return src[:j]
+}
+
+// composeKanaRunes is composeKana for a rune slice.
+func composeKanaRunes(src []rune) []rune {
+	prevPos := -1 // position of the previous rune, or -1 if it can't be composed
+	j := 0
+	for _, r := range src {
+		if (r == voicedMark || r == semiVoicedMark) && prevPos >= 0 {
+			if c, ok := composedKana[[2]rune{src[prevPos], r}]; ok {
+				src[prevPos] = c
+				prevPos = -1
+				continue
+			}
+		}
+		src[j] = r
+		prevPos = j
+		j++
+	}
+	return src[:j]
+}
+
+// holdBack returns the number of bytes at the end of buf
+// that may be composed with a combining mark following buf.
+func holdBack(buf []byte) int {
+	// An incomplete rune at the end may be a combining mark.
+	n := incompleteRune(buf)
+	buf = buf[:len(buf)-n]
+
+	// The last kana may be composed with it.
+	r, size := utf8.DecodeLastRune(buf)
+	if _, ok := composableKana[r]; ok {
+		n += size
+	}
+	return n
+}
@@ -0,0 +1,147 @@
+package base64dq
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// decompose decomposes the precomposed kana in s.
+func decompose(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		found := false
+		for k, c := range composedKana {
+			if c == r {
+				b.WriteRune(k[0])
+				b.WriteRune(k[1])
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func TestWithKanaComposition(t *testing.T) {
+	enc := StdEncoding.WithKanaComposition()
+	for _, p := range pairs {
+		for _, input := range []string{p.encoded, decompose(p.encoded)} {
+			decoded, err := enc.DecodeString(input)
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", input, err)
+			}
+			if string(decoded) != p.decoded {
+				t.Errorf("Decode(%q) = %q, want %q", input, decoded, p.decoded)
+			}
+
+			decoded, err = io.ReadAll(NewDecoder(enc, strings.NewReader(input)))
+			if err != nil {
+				t.Errorf("Decoder(%q) = %v", input, err)
+			}
+			if string(decoded) != p.decoded {
+				t.Errorf("Decoder(%q) = %q, want %q", input, decoded, p.decoded)
+			}
+		}
+	}
+
+	// the original encoding doesn't compose them.
+	if _, err := StdEncoding.DecodeString(decompose("がぎぐげ")); err == nil {
+		t.Error("StdEncoding wrongly composed combining marks")
+	}
+}
+
+// chunkReader returns the chunks in order, one per Read call.
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks[0] = r.chunks[0][n:]
+	if r.chunks[0] == "" {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestWithKanaComposition_Streaming(t *testing.T) {
+	enc := StdEncoding.WithKanaComposition()
+	input := decompose(bigtest.encoded)
+
+	readers := map[string]func() io.Reader{
+		"OneByteReader": func() io.Reader { return iotest.OneByteReader(strings.NewReader(input)) },
+		"HalfReader":    func() io.Reader { return iotest.HalfReader(strings.NewReader(input)) },
+		"DataErrReader": func() io.Reader { return iotest.DataErrReader(strings.NewReader(input)) },
+	}
+
+	// split the input at every byte boundary,
+	// so that the combining marks appear at the beginning of the chunks.
+	for i := 1; i < len(input); i++ {
+		i := i
+		readers["split/"+strconv.Itoa(i)] = func() io.Reader {
+			return &chunkReader{chunks: []string{input[:i], input[i:]}}
+		}
+	}
+
+	for name, newReader := range readers {
+		decoded, err := io.ReadAll(NewDecoder(enc, newReader()))
+		if err != nil {
+			t.Errorf("%s: Decoder(%q) = %v", name, input, err)
+		}
+		if string(decoded) != bigtest.decoded {
+			t.Errorf("%s: Decoder(%q) = %q, want %q", name, input, decoded, bigtest.decoded)
+		}
+	}
+}
+
+func TestHoldBack(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"あ", 0},
+		{"か", len("か")},
+		{"がか", len("か")},
+		{"が", 0},
+		{"か\xe3", len("か\xe3")},
+		{"か\xe3\x82", len("か\xe3\x82")},
+		{"あ\xe3\x82", len("\xe3\x82")},
+		{"\xe3\x82", len("\xe3\x82")},
+	} {
+		if got := holdBack([]byte(tt.input)); got != tt.want {
+			t.Errorf("holdBack(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestComposeKana(t *testing.T) {
+	for _, tt := range []struct {
+		input, want string
+	}{
+		{"", ""},
+		{"かきくけこ", "かきくけこ"},
+		{"か\u3099", "が"},
+		{"は\u309a", "ぱ"},
+		{"ハ\u3099ハ\u309a", "バパ"},
+		{"う\u3099", "ゔ"},
+		{"\u3099か", "\u3099か"},
+		{"あ\u3099", "あ\u3099"},
+		{"か\u3099\u3099", "が\u3099"},
+		{"\xffか\u3099\xff", "\xffが\xff"},
+	} {
+		input := []byte(tt.input)
+		if got := string(composeKana(input, nil)); got != tt.want {
+			t.Errorf("composeKana(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package base64dq
+
+// WithConcatenated creates a new encoding identical to enc except
+// that the decoder continues decoding after the padding,
+// like "base64 -d" over concatenated messages.
+// A padded block ends a stream, and the next block starts a new stream,
+// so the concatenation of padded base64dq strings decodes to the concatenation of their data.
+// Without it, the decoder reports ErrTrailingGarbage for the data after the padding.
+//
+// The streams must be padded to be separated; it has no effect if enc has no padding.
+func (enc *Encoding) WithConcatenated() *Encoding {
+	e := enc.Clone()
+	e.concat = true
+	e.dfa = enc.dfa // the decoder restarts from the root of the same DFA.
+	return e
+}
@@ -0,0 +1,101 @@
+package base64dq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWithConcatenated(t *testing.T) {
+	for _, tt := range []struct {
+		enc    *Encoding
+		input  string
+		want   string
+		offset int // -1 means no corruption.
+		err    error
+	}{
+		{StdEncoding, "はらぶげ", "foo", -1, nil},
+		{StdEncoding, "はむ・・はむ・・", "ff", -1, nil},
+		{StdEncoding, "はらぶげのらか・はむ・・\n", "foobaf", -1, nil},
+		{StdEncoding, "はむ・・\nはらぶげ\nはむ・・", "ffoof", -1, nil},
+		{StdEncoding, "はむ・・はら", "", len("はむ・・"), ErrTruncated},
+		{StdEncoding, "はむ・・は!", "", len("はむ・・は"), ErrInvalidRune},
+		{StdEncoding, "はむ・・・", "", len("はむ・・"), ErrBadPadding},
+		{StdEncoding.Strict(), "はむ・・はめ・・", "", len("はむ・・はめ"), ErrTrailingBits},
+	} {
+		enc := tt.enc.WithConcatenated()
+		decoders := map[string]func() ([]byte, error){
+			"Decode": func() ([]byte, error) {
+				return enc.DecodeString(tt.input)
+			},
+			"DecodeRunewise": func() ([]byte, error) {
+				dst := make([]byte, enc.DecodedLen(len(tt.input)))
+				n, err := enc.DecodeRunewise(dst, []byte(tt.input))
+				return dst[:n], err
+			},
+			"DecodeConstantTime": func() ([]byte, error) {
+				return enc.WithConstantTime().DecodeString(tt.input)
+			},
+			"Decoder": func() ([]byte, error) {
+				return io.ReadAll(NewDecoder(enc, strings.NewReader(tt.input)))
+			},
+			"DecoderOneByte": func() ([]byte, error) {
+				return io.ReadAll(NewDecoder(enc, iotest.OneByteReader(strings.NewReader(tt.input))))
+			},
+		}
+		for name, decode := range decoders {
+			got, err := decode()
+			if tt.err == nil {
+				if err != nil || string(got) != tt.want {
+					t.Errorf("%s(%q) = %q, %v, want %q", name, tt.input, got, err, tt.want)
+				}
+				continue
+			}
+			var e *DecodeError
+			if !errors.As(err, &e) || e.Err != tt.err || e.ByteOffset != tt.offset {
+				t.Errorf("%s(%q) error = %v, want %v at %d", name, tt.input, err, tt.err, tt.offset)
+			}
+		}
+		if tt.err == nil {
+			if n := enc.DecodedLenString(tt.input); n != len(tt.want) {
+				t.Errorf("DecodedLenString(%q) = %d, want %d", tt.input, n, len(tt.want))
+			}
+		}
+	}
+
+	// the data after the padding is trailing garbage by default.
+	if _, err := StdEncoding.DecodeString("はむ・・はむ・・"); !errors.Is(err, ErrTrailingGarbage) {
+		t.Errorf("DecodeString error = %v, want ErrTrailingGarbage", err)
+	}
+}
+
+func TestWithConcatenated_Stream(t *testing.T) {
+	enc := StdEncoding.WithConcatenated()
+	var want, input strings.Builder
+	for i := 0; i < 100; i++ {
+		data := fmt.Sprint(i)
+		want.WriteString(data)
+		input.WriteString(StdEncoding.EncodeToString([]byte(data)))
+	}
+	for _, bs := range []int{1, 2, 3, 4, 100} {
+		d := NewDecoder(enc, iotest.HalfReader(strings.NewReader(input.String())))
+		var got []byte
+		buf := make([]byte, bs)
+		for {
+			n, err := d.Read(buf)
+			got = append(got, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if string(got) != want.String() {
+			t.Errorf("buffer size %d: decoded %q, want %q", bs, got, want.String())
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package base64dq
+
+import (
+	"crypto/subtle"
+	"unicode/utf8"
+)
+
+// WithConstantTime creates a new encoding identical to enc except
+// that Decode and the functions built on it, such as DecodeString, AppendDecode and Validate,
+// as well as DecodeRunewise and DecodeRunes, look up every rune in the whole table of the accepted runes with constant-time comparisons,
+// and don't stop at the first error.
+// The time to decode depends on the length of the input, the UTF-8 lengths of its runes,
+// and the positions of the padding and the ignored runes, but not on the decoded data.
+// It is slower than the default mode, and is intended for decoding secret material.
+//
+// The errors are the same as Decode, but reported after the whole input is processed.
+// The stream decoder, DecodedLenString, WithKanaComposition and WithIgnoreInvalid
+// don't run in constant time.
+func (enc *Encoding) WithConstantTime() *Encoding {
+	e := enc.Clone()
+	e.constantTime = true
+	e.dfa = enc.dfa // the DFA isn't used, but is shared with the other modes.
+	return e
+}
+
+// EqualFold reports whether a and b, encoded with enc, represent the same data,
+// comparing them in constant time without decoding them.
+// The runes that enc ignores, such as CR and LF, are dropped before the comparison,
+// and the aliases are compared as the alphabet runes they map to,
+// so that the same password wrapped differently is equal.
+// It returns false if a or b contains a rune that enc doesn't accept.
+//
+// Like WithConstantTime, the time depends on the lengths of a and b
+// and the positions of the ignored runes, but not on the data.
+// It doesn't check the padding nor the length of the data as Decode does.
+func EqualFold(enc *Encoding, a, b string) bool {
+	ca, oka := enc.canonical(a)
+	cb, okb := enc.canonical(b)
+	return subtle.ConstantTimeCompare(ca, cb)&oka&okb == 1
+}
+
+// canonical returns the 6-bit values of the runes in s, or paddingNode for the padding,
+// looking them up in constant time.
+// ok is 1 if all the runes in s are accepted by enc, or 0 otherwise.
+func (enc *Encoding) canonical(s string) (values []byte, ok int) {
+	src := []byte(s)
+	if enc.compose && hasCombiningMark(src) {
+		src = composeKana(src, nil)
+	}
+	m := enc.decodeMap()
+	values = make([]byte, 0, len(src))
+	ok = 1
+	for i := bomLen(enc, src); i < len(src); {
+		r, size := utf8.DecodeRune(src[i:])
+		i += size
+		v, found := m.searchConstantTime(r)
+		if !found || (r == utf8.RuneError && size == 1) {
+			if !enc.ignoreInvalid {
+				ok = 0
+			}
+			continue
+		}
+		if v == rootNode {
+			continue
+		}
+		values = append(values, byte(v))
+	}
+	return values, ok
+}
+
+// searchConstantTime is like search, but compares r with every rune in m
+// in constant time.
+func (m decodeMap) searchConstantTime(r rune) (int, bool) {
+	v, found := 0, 0
+	for _, e := range m {
+		eq := subtle.ConstantTimeEq(int32(e.r), int32(r))
+		v = subtle.ConstantTimeSelect(eq, e.v, v)
+		found |= eq
+	}
+	return v, found == 1
+}
+
+// decodeConstantTime is decode for the encodings with WithConstantTime.
+// It is also used by DecodeRunewise and DecodeRunes.
+// Once it finds an error, it keeps looking up the rest of the runes,
+// and reports the first error at the end.
+func decodeConstantTime(enc *Encoding, dst, src []byte, write bool) (int, error) {
+	// Decode quantum using the base64 alphabet
+	var dbuf [4]byte
+
+	m := enc.decodeMap()
+	i := bomLen(enc, src)
+	padCount := 0
+	lastBlock := i // position of last block boundary
+	lastRune := i  // position of last rune that contributed to the output
+	j := 0
+	k := 0
+	var err error  // first error
+	final := false // whether the final block has been decoded
+	var bits uint  // trailing bits of the final block
+	bitsAt := 0    // position of the trailing bits
+
+	for i < len(src) {
+		start := i
+		r, size := utf8.DecodeRune(src[i:])
+		v, ok := m.searchConstantTime(r)
+		i += size
+		if err != nil {
+			// keep looking up the runes so that the time doesn't depend on the error.
+			continue
+		}
+		if r == utf8.RuneError && size == 1 {
+			ok = false
+		}
+		if final {
+			// only the ignored runes are allowed after the final block.
+			if !ok || v != rootNode {
+				err = newDecodeError(src, start, ErrTrailingGarbage)
+			}
+			continue
+		}
+		if padCount > 0 && v != paddingNode && v != rootNode {
+			// only the padding and the ignored runes can follow the padding.
+			ok = false
+		}
+		if !ok {
+			if invalidUTF8(src[start:]) {
+				err = newDecodeError(src, start, ErrInvalidUTF8)
+			} else {
+				err = newDecodeError(src, lastRune, ErrInvalidRune)
+			}
+			continue
+		}
+
+		if v == rootNode {
+			continue
+		}
+		isPadding := v == paddingNode
+		if isPadding {
+			if j%4 < 2 {
+				// incorrect padding
+				err = newDecodeError(src, lastRune, ErrBadPadding)
+				continue
+			}
+			padCount++
+			v = 0
+			if enc.singlePad && j%4 == 2 {
+				// the single padding completes the block of two alphabet runes.
+				dbuf[2] = 0
+				j++
+				padCount++
+			}
+		}
+
+		dbuf[j%4] = byte(v)
+		j++
+		if j%4 == 0 {
+			lastBlock = i
+			// Convert 4x 6bit source bytes into 3 bytes
+			val := uint(dbuf[0])<<18 | uint(dbuf[1])<<12 | uint(dbuf[2])<<6 | uint(dbuf[3])
+			size := 3 - padCount
+			if padCount > 2 {
+				err = newDecodeError(src, lastRune, ErrBadPadding)
+				continue
+			}
+			if write {
+				if len(dst)-k < size {
+					err = ErrShortBuffer
+					continue
+				}
+				dst[k+0] = byte(val >> 16)
+				if size > 1 {
+					dst[k+1] = byte(val >> 8)
+				}
+				if size > 2 {
+					dst[k+2] = byte(val >> 0)
+				}
+			}
+			k += size
+			if padCount > 0 && enc.concat {
+				// start the next stream.
+				if enc.strict && subtle.ConstantTimeEq(int32(val&(1<<(8*padCount)-1)), 0) == 0 {
+					err = newDecodeError(src, lastRune, ErrTrailingBits)
+				}
+				padCount, lastRune = 0, i
+				continue
+			}
+			if padCount > 0 {
+				final = true
+				bits, bitsAt = val&(1<<(8*padCount)-1), lastRune
+				continue
+			}
+		}
+		if !isPadding {
+			lastRune = i
+		}
+	}
+
+	// handle remaining bytes and padding
+	if err == nil && !final && j%4 != 0 {
+		switch {
+		case enc.padChar != NoPadding && padCount == 0:
+			err = newDecodeError(src, lastBlock, ErrTruncated)
+		case enc.padChar != NoPadding, j%4 == 1:
+			err = newDecodeError(src, i, ErrTruncated)
+		default:
+			// Convert 4x 6bit source bytes into 3 bytes
+			for i := j % 4; i < 4; i++ {
+				dbuf[i] = 0
+			}
+			val := uint(dbuf[0])<<18 | uint(dbuf[1])<<12 | uint(dbuf[2])<<6 | uint(dbuf[3])
+			size := j%4 - 1
+			if write && len(dst)-k < size {
+				err = ErrShortBuffer
+				break
+			}
+			if write {
+				dst[k+0] = byte(val >> 16)
+				if size > 1 {
+					dst[k+1] = byte(val >> 8)
+				}
+			}
+			k += size
+			final = true
+			bits, bitsAt = val&(1<<(8*(3-size))-1), lastRune
+		}
+	}
+	if final && enc.strict && subtle.ConstantTimeEq(int32(bits), 0) == 0 {
+		// the trailing bits precede the errors after the final block.
+		err = newDecodeError(src, bitsAt, ErrTrailingBits)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if write && enc.checksum != nil {
+		return enc.verifyChecksum(dst[:k])
+	}
+	return k, nil
+}
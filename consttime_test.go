@@ -0,0 +1,75 @@
+package base64dq
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWithConstantTime(t *testing.T) {
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			enc := tt.enc.WithConstantTime()
+			encoded := tt.conv(p.encoded)
+			got, err := enc.DecodeString(encoded)
+			if err != nil {
+				t.Errorf("DecodeString(%q) = %v", encoded, err)
+				continue
+			}
+			if string(got) != p.decoded {
+				t.Errorf("DecodeString(%q) = %q, want %q", encoded, got, p.decoded)
+			}
+		}
+	}
+
+	// the errors are the same as the default mode.
+	for _, base := range []*Encoding{StdEncoding, RawStdEncoding, StdEncoding.Strict(), RawStdEncoding.Strict()} {
+		enc := base.WithConstantTime()
+		for _, tc := range decodeCorruptTestCases {
+			want, wantErr := base.DecodeString(tc.input)
+			got, err := enc.DecodeString(tc.input)
+			if fmt.Sprintf("%q %#v", got, err) != fmt.Sprintf("%q %#v", want, wantErr) {
+				t.Errorf("%v: DecodeString(%q) = %q, %#v, want %q, %#v", base, tc.input, got, err, want, wantErr)
+			}
+
+			dst := make([]byte, base.DecodedLen(len(tc.input)))
+			n, err := enc.DecodeRunewise(dst, []byte(tc.input))
+			if fmt.Sprintf("%q %#v", dst[:n], err) != fmt.Sprintf("%q %#v", want, wantErr) {
+				t.Errorf("%v: DecodeRunewise(%q) = %q, %#v, want %q, %#v", base, tc.input, dst[:n], err, want, wantErr)
+			}
+		}
+	}
+
+	dst := make([]byte, 2)
+	if _, err := StdEncoding.WithConstantTime().Decode(dst, []byte("はらぶげ")); err != ErrShortBuffer {
+		t.Errorf("Decode error = %v, want ErrShortBuffer", err)
+	}
+}
+
+func TestEqualFold(t *testing.T) {
+	for _, tt := range []struct {
+		enc  *Encoding
+		a, b string
+		want bool
+	}{
+		{StdEncoding, "はらぶげのらか・", "はらぶげのらか・", true},
+		{StdEncoding, "はらぶげのらか・", "はらぶげ\nのらか・", true},
+		{StdEncoding, "はらぶ\r\nげのらか・\n", "\nはらぶげ\nのらか・", true},
+		{StdEncoding, "はらぶげのらか・", "はらぶげのらき・", false},
+		{StdEncoding, "はらぶげのらか・", "はらぶげのらか", false},
+		{StdEncoding, "はらぶげ", "はらぶげ！", false},
+		{StdEncoding, "はらぶげ！", "はらぶげ！", false},
+		{StdEncoding, "", "\n", true},
+		{StdEncoding.WithAliases(map[rune]rune{'ハ': 'は'}), "はらぶげ", "ハらぶげ", true},
+		{StdEncoding.WithKanaComposition(), "はらぶげ", "はらふ\u3099け\u3099", true},
+		{StdEncoding.WithIgnoreInvalid(), "はらぶげ", "は！らぶげ", true},
+		{StdEncoding.WithSkipBOM(), "\uFEFFはらぶげ", "はらぶげ", true},
+		{KatakanaEncoding, "ハラブゲ", "ハラブゲ\n", true},
+	} {
+		if got := EqualFold(tt.enc, tt.a, tt.b); got != tt.want {
+			t.Errorf("EqualFold(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+		if got := EqualFold(tt.enc, tt.b, tt.a); got != tt.want {
+			t.Errorf("EqualFold(%q, %q) = %t, want %t", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
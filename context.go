@@ -0,0 +1,98 @@
+package base64dq
+
+import (
+	"context"
+	"io"
+)
+
+// NewEncoderContext is like NewEncoder, but the encoder aborts with ctx.Err()
+// once ctx is done.
+// It checks ctx on each Write and Close, and before each write of its buffered output to w,
+// so a cancelled encode stops between the chunks instead of writing the rest.
+// It can't interrupt a w.Write that is already blocked.
+func NewEncoderContext(ctx context.Context, enc *Encoding, w io.Writer) io.WriteCloser {
+	e := NewEncoder(enc, &ctxWriter{ctx: ctx, w: w}).(Encoder)
+	return &ctxEncoder{ctx: ctx, e: e}
+}
+
+// NewDecoderContext is like NewDecoder, but the decoder aborts with ctx.Err()
+// once ctx is done.
+// It checks ctx before each read of a chunk from r.
+// It can't interrupt an r.Read that is already blocked.
+func NewDecoderContext(ctx context.Context, enc *Encoding, r io.Reader) io.Reader {
+	d := NewDecoder(enc, &ctxReader{ctx: ctx, r: r}).(Decoder)
+	return &ctxDecoder{ctx: ctx, d: d}
+}
+
+type ctxEncoder struct {
+	ctx context.Context
+	e   Encoder
+}
+
+func (e *ctxEncoder) Write(p []byte) (int, error) {
+	if err := e.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return e.e.Write(p)
+}
+
+func (e *ctxEncoder) Close() error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+	return e.e.Close()
+}
+
+func (e *ctxEncoder) Flush() error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+	return e.e.Flush()
+}
+
+func (e *ctxEncoder) Reset(w io.Writer) {
+	e.e.Reset(&ctxWriter{ctx: e.ctx, w: w})
+}
+
+type ctxDecoder struct {
+	ctx context.Context
+	d   Decoder
+}
+
+func (d *ctxDecoder) Read(p []byte) (int, error) {
+	return d.d.Read(p)
+}
+
+func (d *ctxDecoder) InputOffset() int64 {
+	return d.d.InputOffset()
+}
+
+func (d *ctxDecoder) Reset(r io.Reader) {
+	d.d.Reset(&ctxReader{ctx: d.ctx, r: r})
+}
+
+// ctxWriter is an io.Writer that fails once ctx is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// ctxReader is an io.Reader that fails once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
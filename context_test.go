@@ -0,0 +1,73 @@
+package base64dq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// cancelWriter cancels the context on the first write.
+type cancelWriter struct {
+	cancel context.CancelFunc
+	writes int
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.writes++
+	w.cancel()
+	return len(p), nil
+}
+
+func TestNewEncoderContext(t *testing.T) {
+	var buf strings.Builder
+	e := NewEncoderContext(context.Background(), StdEncoding, &buf)
+	if _, err := io.WriteString(e, bigtest.decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != bigtest.encoded {
+		t.Errorf("encoded %q, want %q", buf.String(), bigtest.encoded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelWriter{cancel: cancel}
+	e = NewEncoderContext(ctx, StdEncoding, w)
+	if _, err := e.Write(make([]byte, 10000)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Write error = %v, want context.Canceled", err)
+	}
+	if w.writes != 1 {
+		t.Errorf("the encoder wrote %d times after the cancellation, want 1", w.writes)
+	}
+	if err := e.Close(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Close error = %v, want context.Canceled", err)
+	}
+}
+
+func TestNewDecoderContext(t *testing.T) {
+	got, err := io.ReadAll(NewDecoderContext(context.Background(), StdEncoding, strings.NewReader(bigtest.encoded)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != bigtest.decoded {
+		t.Errorf("decoded %q, want %q", got, bigtest.decoded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d := NewDecoderContext(ctx, StdEncoding, iotest.OneByteReader(strings.NewReader(bigtest.encoded)))
+	if _, err := io.ReadAll(d); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadAll error = %v, want context.Canceled", err)
+	}
+
+	// Reset keeps the context.
+	d.(Decoder).Reset(strings.NewReader(bigtest.encoded))
+	if _, err := io.ReadAll(d); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadAll after Reset error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,66 @@
+package base64dq
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// CleanPassword removes the white spaces from s, so that a password
+// displayed across multiple lines with spaces between groups can be decoded as is.
+// It removes the ASCII spaces, the full-width spaces (U+3000), and all the line breaks,
+// such as CR, LF, NEL (U+0085), and LINE SEPARATOR (U+2028),
+// unless they are in the alphabet of enc or are its padding, e.g. U+3000 in NameEncoding.
+// The other runes are kept as is, so that the decoder reports the invalid ones.
+func (enc *Encoding) CleanPassword(s string) string {
+	m := enc.decodeMap()
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsSpace(r) {
+			return r
+		}
+		if v, ok := m.search(r); ok && v >= 0 {
+			// the alphabet, the aliases, and the padding.
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// EncodeGrouped returns the encoding of src with sep inserted after every groupRunes alphabet runes,
+// e.g. groups of 5 runes separated by a space as DQ1 displays the passwords.
+// The padding is kept with the last group, and sep is not written after the last group.
+// If groupRunes <= 0, the output is not grouped.
+//
+// sep may contain any rune that enc doesn't decode as the alphabet, its aliases, or the padding,
+// such as a space, a hyphen, or a line break.
+// It returns an error if sep contains such a rune, because the output wouldn't decode.
+// The output decodes with an encoding that ignores the runes of sep:
+// enc itself for "\n" or "\r\n", or e.g. enc.WithIgnoredRunes(' ') for a space.
+func (enc *Encoding) EncodeGrouped(src []byte, groupRunes int, sep string) (string, error) {
+	m := enc.decodeMap()
+	for _, r := range sep {
+		if v, ok := m.search(r); ok && v >= 0 {
+			return "", fmt.Errorf("base64dq: separator contains the rune %q of the encoding", r)
+		}
+	}
+
+	s := enc.EncodeToString(src)
+	if groupRunes <= 0 {
+		return s, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + len(s)/groupRunes*len(sep))
+	count := 0
+	for _, r := range s {
+		if r != enc.padChar {
+			if count == groupRunes {
+				b.WriteString(sep)
+				count = 0
+			}
+			count++
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,87 @@
+package base64dq
+
+import "testing"
+
+func TestCleanPassword(t *testing.T) {
+	for _, tt := range []struct {
+		enc   *Encoding
+		input string
+		want  string
+	}{
+		{StdEncoding, "", ""},
+		{StdEncoding, "おさべつに はほわげげ\nだどべうき　さそさには", "おさべつにはほわげげだどべうきさそさには"},
+		{StdEncoding, "はらぶげ\r\nのらか・  \u0085\t", "はらぶげのらか・"},
+		{StdEncoding, "はらぶげ！", "はらぶげ！"},
+		{NameEncoding, "ゆうしゃ　 \n", "ゆうしゃ　"},
+	} {
+		if got := tt.enc.CleanPassword(tt.input); got != tt.want {
+			t.Errorf("CleanPassword(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	decoded, err := StdEncoding.DecodeString(StdEncoding.CleanPassword("おさべつに はほわげげ だどべうき さそさには"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "\x10\xaf\x91\x55\x97\x6b\xbe\xfd\xba\xf8\x21\x8a\x38\xa5\x59" {
+		t.Errorf("unexpected decoded: %q", decoded)
+	}
+}
+
+func TestEncodeGrouped(t *testing.T) {
+	src := []byte("\x10\xaf\x91\x55\x97\x6b\xbe\xfd\xba\xf8\x21\x8a\x38\xa5\x59")
+	for _, tt := range []struct {
+		enc        *Encoding
+		src        []byte
+		groupRunes int
+		sep        string
+		want       string
+	}{
+		{StdEncoding, src, 5, " ", "おさべつに はほわげげ だどべうき さそさには"},
+		{StdEncoding, src, 10, "\n", "おさべつにはほわげげ\nだどべうきさそさには"},
+		{StdEncoding, src, 0, " ", "おさべつにはほわげげだどべうきさそさには"},
+		{StdEncoding, []byte("f"), 3, "-", "はむ・・"},
+		{StdEncoding, []byte("foob"), 3, "-", "はらぶ-げのむ・・"},
+		{StdEncoding, []byte("foob"), 2, "-", "はら-ぶげ-のむ・・"},
+		{StdEncoding, nil, 5, " ", ""},
+	} {
+		got, err := tt.enc.EncodeGrouped(tt.src, tt.groupRunes, tt.sep)
+		if err != nil {
+			t.Errorf("EncodeGrouped(%q, %d, %q) error = %v", tt.src, tt.groupRunes, tt.sep, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("EncodeGrouped(%q, %d, %q) = %q, want %q", tt.src, tt.groupRunes, tt.sep, got, tt.want)
+		}
+	}
+
+	// the grouped output decodes with the encoding ignoring the separator.
+	for _, tt := range []struct {
+		enc *Encoding
+		sep string
+	}{
+		{StdEncoding, "\n"},
+		{StdEncoding, "\r\n"},
+		{StdEncoding.WithIgnoredRunes(' '), " "},
+		{StdEncoding.WithIgnoredRunes('-'), "-"},
+	} {
+		for _, p := range pairs {
+			s, err := tt.enc.EncodeGrouped([]byte(p.decoded), 3, tt.sep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := tt.enc.DecodeString(s)
+			if err != nil || string(decoded) != p.decoded {
+				t.Errorf("DecodeString(%q) = %q, %v, want %q", s, decoded, err, p.decoded)
+			}
+		}
+	}
+}
+
+func TestEncodeGrouped_InvalidSeparator(t *testing.T) {
+	for _, sep := range []string{"あ", " ・ "} {
+		if s, err := StdEncoding.EncodeGrouped([]byte("foo"), 2, sep); err == nil {
+			t.Errorf("EncodeGrouped with separator %q = %q, want an error", sep, s)
+		}
+	}
+}
@@ -3,6 +3,7 @@
 package base64dq_test
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -78,3 +79,44 @@ func ExampleNewEncoder() {
 	// Output:
 	// はらぶげあきこめへむ・・
 }
+
+func ExampleEncoding_WithAliases() {
+	// accept ASCII digits as well as full-width digits.
+	enc := base64dq.NameEncoding.WithAliases(map[rune]rune{
+		'0': '０', '1': '１', '2': '２', '3': '３', '4': '４',
+		'5': '５', '6': '６', '7': '７', '8': '８', '9': '９',
+	})
+	data, err := enc.DecodeString("0123")
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Printf("%q\n", data)
+	fmt.Println(enc.EncodeToString(data))
+	// Output:
+	// "\x00\x10\x83"
+	// ０１２３
+}
+
+func ExampleDecodeError() {
+	_, err := base64dq.StdEncoding.DecodeString("はらぶげ・・")
+
+	// the cause of the corruption
+	fmt.Println(errors.Is(err, base64dq.ErrBadPadding))
+
+	// the position of the corruption
+	var decodeErr *base64dq.DecodeError
+	if errors.As(err, &decodeErr) {
+		fmt.Println(decodeErr.ByteOffset, decodeErr.RuneIndex)
+	}
+
+	// the offset in bytes, compatible with the older versions
+	var cie base64dq.CorruptInputError
+	if errors.As(err, &cie) {
+		fmt.Println(int64(cie))
+	}
+	// Output:
+	// true
+	// 12 4
+	// 12
+}
@@ -2,42 +2,20 @@ package base64dq
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"unicode/utf8"
 )
 
-// validate alphabets
-func validAlphabets(alphabets string) bool {
-	if !utf8.ValidString(alphabets) {
-		return false
-	}
-	if utf8.RuneCountInString(alphabets) != 64 {
-		return false
-	}
-	if strings.ContainsRune(alphabets, utf8.RuneError) {
-		return false
-	}
-	if strings.ContainsAny(alphabets, "・\n\r") {
-		return false
-	}
-	seen := map[rune]bool{}
-	for _, r := range alphabets {
-		if seen[r] {
-			return false
-		}
-		seen[r] = true
-	}
-	return true
-}
-
 func FuzzEncode(f *testing.F) {
 	for _, p := range pairs {
 		f.Add(encodeStd, []byte(p.encoded))
 	}
 	f.Fuzz(func(t *testing.T, alphabets string, data []byte) {
-		if !validAlphabets(alphabets) {
+		if ValidAlphabet(alphabets) != nil {
 			return
 		}
 		enc := NewEncoding(alphabets)
@@ -57,7 +35,7 @@ func FuzzEncoder(f *testing.F) {
 		f.Add(encodeStd, []byte(p.encoded))
 	}
 	f.Fuzz(func(t *testing.T, alphabets string, data []byte) {
-		if !validAlphabets(alphabets) {
+		if ValidAlphabet(alphabets) != nil {
 			return
 		}
 		enc := NewEncoding(alphabets)
@@ -88,7 +66,7 @@ func FuzzDecode(f *testing.F) {
 		f.Add(encodeStd, t.input)
 	}
 	f.Fuzz(func(t *testing.T, alphabets, data string) {
-		if !validAlphabets(alphabets) {
+		if ValidAlphabet(alphabets) != nil {
 			return
 		}
 		enc := NewEncoding(alphabets)
@@ -115,12 +93,18 @@ func FuzzDecoder(f *testing.F) {
 		f.Add(encodeStd, t.input)
 	}
 	f.Fuzz(func(t *testing.T, alphabets, data string) {
-		if !validAlphabets(alphabets) {
+		if ValidAlphabet(alphabets) != nil {
 			return
 		}
 		enc := NewEncoding(alphabets)
 		d := NewDecoder(enc, strings.NewReader(data))
 		decoded, err := io.ReadAll(d)
+
+		// reading one byte at a time returns the same result.
+		want, wantErr := io.ReadAll(NewDecoder(enc, iotest.OneByteReader(strings.NewReader(data))))
+		if string(decoded) != string(want) || fmt.Sprintf("%#v", err) != fmt.Sprintf("%#v", wantErr) {
+			t.Errorf("%q: decoded %q, %#v, want %q, %#v", data, decoded, err, want, wantErr)
+		}
 		if err != nil {
 			return
 		}
@@ -134,3 +118,128 @@ func FuzzDecoder(f *testing.F) {
 		}
 	})
 }
+
+func FuzzDecodeRunewise(f *testing.F) {
+	for _, p := range pairs {
+		f.Add(encodeStd, p.encoded)
+	}
+	for _, t := range decodeCorruptTestCases {
+		f.Add(encodeStd, t.input)
+	}
+	f.Fuzz(func(t *testing.T, alphabets, data string) {
+		if ValidAlphabet(alphabets) != nil {
+			return
+		}
+		enc := NewEncoding(alphabets)
+		dbuf := make([]byte, enc.DecodedLen(len(data)))
+		n, err := enc.Decode(dbuf, []byte(data))
+		want := fmt.Sprintf("%q %v", dbuf[:n], err)
+
+		dbuf = make([]byte, enc.DecodedLen(len(data)))
+		n, err = enc.DecodeRunewise(dbuf, []byte(data))
+		got := fmt.Sprintf("%q %v", dbuf[:n], err)
+		if got != want {
+			t.Errorf("DecodeRunewise(%q) = %s, want %s", data, got, want)
+		}
+	})
+}
+
+func FuzzDecodeConstantTime(f *testing.F) {
+	for _, p := range pairs {
+		f.Add(p.encoded, false, false)
+	}
+	for _, t := range decodeCorruptTestCases {
+		f.Add(t.input, true, true)
+	}
+	f.Fuzz(func(t *testing.T, data string, raw, strict bool) {
+		enc := StdEncoding
+		if raw {
+			enc = RawStdEncoding
+		}
+		if strict {
+			enc = enc.Strict()
+		}
+		want, wantErr := enc.DecodeString(data)
+		got, err := enc.WithConstantTime().DecodeString(data)
+		if fmt.Sprintf("%q %#v", got, err) != fmt.Sprintf("%q %#v", want, wantErr) {
+			t.Errorf("DecodeString(%q) = %q, %#v, want %q, %#v", data, got, err, want, wantErr)
+		}
+	})
+}
+
+func FuzzDecodeIgnoreInvalid(f *testing.F) {
+	for _, p := range pairs {
+		f.Add(p.encoded, false)
+	}
+	for _, t := range decodeCorruptTestCases {
+		f.Add(t.input, true)
+	}
+	f.Fuzz(func(t *testing.T, data string, compose bool) {
+		enc := StdEncoding
+		if compose {
+			enc = enc.WithKanaComposition()
+		}
+		enc = enc.WithIgnoreInvalid()
+		decoded, wantErr := enc.DecodeString(data)
+		want := fmt.Sprintf("%q %v", decoded, wantErr)
+
+		dbuf := make([]byte, enc.DecodedLen(len(data)))
+		n, err := enc.DecodeRunewise(dbuf, []byte(data))
+		if got := fmt.Sprintf("%q %v", dbuf[:n], err); got != want {
+			t.Errorf("DecodeRunewise(%q) = %s, want %s", data, got, want)
+		}
+
+		decoded2, err := io.ReadAll(NewDecoder(enc, iotest.OneByteReader(strings.NewReader(data))))
+		if (err == nil) != (wantErr == nil) || (err == nil && string(decoded2) != string(decoded)) {
+			t.Errorf("Decoder(%q) = %q, %v, want %s", data, decoded2, err, want)
+		}
+	})
+}
+
+func FuzzSinglePadding(f *testing.F) {
+	for _, p := range pairs {
+		f.Add([]byte(p.decoded), p.encoded)
+	}
+	for _, t := range decodeCorruptTestCases {
+		f.Add([]byte(t.input), t.input)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, input string) {
+		enc := StdEncoding.WithSinglePadding()
+
+		// the length of the final block is inferred from the encoded data.
+		encoded := enc.EncodeToString(data)
+		if got, want := utf8.RuneCountInString(encoded), enc.EncodedRuneLen(len(data)); got != want {
+			t.Errorf("%q: %d runes, want %d", encoded, got, want)
+		}
+		decoded, err := enc.StrictNoWhitespace().DecodeString(encoded)
+		if err != nil || string(decoded) != string(data) {
+			t.Errorf("%q: decoded %q, %v, want %q", encoded, decoded, err, data)
+		}
+
+		// all the decoders agree.
+		decoded, wantErr := enc.DecodeString(input)
+		want := fmt.Sprintf("%q %v", decoded, wantErr)
+		dbuf := make([]byte, enc.DecodedLen(len(input)))
+		n, err := enc.DecodeRunewise(dbuf, []byte(input))
+		if got := fmt.Sprintf("%q %v", dbuf[:n], err); got != want {
+			t.Errorf("DecodeRunewise(%q) = %s, want %s", input, got, want)
+		}
+		got, err := enc.WithConstantTime().DecodeString(input)
+		if got := fmt.Sprintf("%q %v", got, err); got != want {
+			t.Errorf("DecodeConstantTime(%q) = %s, want %s", input, got, want)
+		}
+		for _, r := range []io.Reader{strings.NewReader(input), iotest.OneByteReader(strings.NewReader(input))} {
+			got, err := io.ReadAll(NewDecoder(enc, r))
+			if (err == nil) != (wantErr == nil) || (err == nil && string(got) != string(decoded)) {
+				t.Errorf("Decoder(%q) = %q, %v, want %s", input, got, err, want)
+			}
+		}
+
+		// exactly one input decodes to given data in the strict mode.
+		if decoded, err := enc.StrictNoWhitespace().DecodeString(input); err == nil {
+			if encoded := enc.EncodeToString(decoded); encoded != input {
+				t.Errorf("%q: decoded %q, which is encoded to %q", input, decoded, encoded)
+			}
+		}
+	})
+}
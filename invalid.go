@@ -0,0 +1,51 @@
+package base64dq
+
+import "unicode/utf8"
+
+// WithIgnoreInvalid creates a new encoding identical to enc except
+// that the decoder skips the runes that it doesn't accept,
+// like the --ignore-garbage option of GNU base64.
+// Unlike the runes added by WithIgnoredRunes, which are skipped by the state machine,
+// the unknown runes and invalid UTF-8 sequences are removed before decoding.
+// The runes in the alphabet must still appear in the right places;
+// e.g. the decoder reports ErrTrailingGarbage for an alphabet rune after the padding.
+//
+// The offsets reported by DecodeError are relative to the input without the skipped runes.
+func (enc *Encoding) WithIgnoreInvalid() *Encoding {
+	e := enc.Clone()
+	e.ignoreInvalid = true
+	e.dfa = enc.dfa // the unknown runes never reach the DFA.
+	return e
+}
+
+// dropInvalid removes the runes that the decoder of enc doesn't accept from src.
+// It modifies src in place, and returns the remaining slice.
+// The combining kana marks must be composed before, as they are removed.
+// The removed runes are recorded in removed.
+func (enc *Encoding) dropInvalid(src []byte, removed *gaps) []byte {
+	m := enc.decodeMap()
+	j := 0
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRune(src[i:])
+		if _, ok := m.search(r); ok && (r != utf8.RuneError || size > 1) {
+			j += copy(src[j:], src[i:i+size])
+		} else {
+			removed.add(j, size)
+		}
+		i += size
+	}
+	return src[:j]
+}
+
+// incompleteRune returns the number of bytes of the incomplete rune at the end of buf.
+func incompleteRune(buf []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(buf); i++ {
+		if isRuneStart(buf[len(buf)-i]) {
+			if !utf8.FullRune(buf[len(buf)-i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return 0
+}
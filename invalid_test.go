@@ -0,0 +1,102 @@
+package base64dq
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWithIgnoreInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		enc   *Encoding
+		input string
+		want  string
+		err   error
+	}{
+		{StdEncoding, "はらぶげ", "foo", nil},
+		{StdEncoding, "は-ら ぶ!げ", "foo", nil},
+		{StdEncoding, "はら\xffぶげ\xe3", "foo", nil},
+		{StdEncoding, "アはらぶげのらか・ア", "fooba", nil},
+		{StdEncoding, "はらぶげのらか・は", "", ErrTrailingGarbage},
+		{StdEncoding, "はら-ぶ", "", ErrTruncated},
+		{RawStdEncoding, "はらぶげのらか・", "fooba", nil},
+		{StdEncoding.WithKanaComposition(), "はらぶげ゙", "foo", nil},
+	} {
+		enc := tt.enc.WithIgnoreInvalid()
+		got, err := enc.DecodeString(tt.input)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("DecodeString(%q) error = %v, want %v", tt.input, err, tt.err)
+			continue
+		}
+		if tt.err != nil {
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("DecodeString(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+		if err := enc.Validate(tt.input); err != nil {
+			t.Errorf("Validate(%q) = %v", tt.input, err)
+		}
+		if n := enc.DecodedLenString(tt.input); n != len(tt.want) {
+			t.Errorf("DecodedLenString(%q) = %d, want %d", tt.input, n, len(tt.want))
+		}
+
+		dbuf := make([]byte, enc.DecodedLen(len(tt.input)))
+		n, err := enc.DecodeRunewise(dbuf, []byte(tt.input))
+		if err != nil || string(dbuf[:n]) != tt.want {
+			t.Errorf("DecodeRunewise(%q) = %q, %v, want %q", tt.input, dbuf[:n], err, tt.want)
+		}
+	}
+}
+
+func TestWithIgnoreInvalid_Streaming(t *testing.T) {
+	encs := map[string]*Encoding{
+		"std":     StdEncoding.WithIgnoreInvalid(),
+		"compose": StdEncoding.WithKanaComposition().WithIgnoreInvalid(),
+	}
+	input := "ア" + strings.Join(strings.SplitAfter(bigtest.encoded, "ら"), "\xe3\x82\x99x") + "\xe3"
+
+	for name, enc := range encs {
+		// split the input at every byte boundary,
+		// so that the invalid runes are split across the chunks.
+		for i := 1; i < len(input); i++ {
+			r := &chunkReader{chunks: []string{input[:i], input[i:]}}
+			decoded, err := io.ReadAll(NewDecoder(enc, r))
+			if err != nil {
+				t.Errorf("%s/%d: Decoder(%q) = %v", name, i, input, err)
+			}
+			if string(decoded) != bigtest.decoded {
+				t.Errorf("%s/%d: Decoder(%q) = %q, want %q", name, i, input, decoded, bigtest.decoded)
+			}
+		}
+	}
+}
+
+func TestWithIgnoreInvalid_Equal(t *testing.T) {
+	if StdEncoding.Equal(StdEncoding.WithIgnoreInvalid()) {
+		t.Error("WithIgnoreInvalid is equal to the original")
+	}
+	if !StdEncoding.WithIgnoreInvalid().Equal(StdEncoding.WithIgnoreInvalid()) {
+		t.Error("WithIgnoreInvalid is not equal to itself")
+	}
+}
+
+func TestIncompleteRune(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"あ", 0},
+		{"a", 0},
+		{"\xff", 0},
+		{"あ\xe3", 1},
+		{"あ\xe3\x82", 2},
+		{"\xf0\x9f\x98", 3},
+	} {
+		if got := incompleteRune([]byte(tt.input)); got != tt.want {
+			t.Errorf("incompleteRune(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
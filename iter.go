@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package base64dq
+
+import (
+	"io"
+	"iter"
+)
+
+// DecodeSeq returns an iterator over the bytes decoded from r.
+// If decoding fails, the iterator yields the error as the last element.
+// The iterator reads r lazily, so breaking the loop stops reading r.
+func (enc *Encoding) DecodeSeq(r io.Reader) iter.Seq2[byte, error] {
+	return func(yield func(byte, error) bool) {
+		d := NewDecoder(enc, r)
+		var buf [512]byte
+		for {
+			n, err := d.Read(buf[:])
+			for _, b := range buf[:n] {
+				if !yield(b, nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(0, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+//go:build go1.23
+
+package base64dq
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSeq(t *testing.T) {
+	for _, p := range pairs {
+		var got []byte
+		for b, err := range StdEncoding.DecodeSeq(strings.NewReader(p.encoded)) {
+			if err != nil {
+				t.Fatalf("DecodeSeq(%q) error = %v", p.encoded, err)
+			}
+			got = append(got, b)
+		}
+		if string(got) != p.decoded {
+			t.Errorf("DecodeSeq(%q) = %q, want %q", p.encoded, got, p.decoded)
+		}
+	}
+}
+
+func TestDecodeSeq_Error(t *testing.T) {
+	var got []byte
+	var errs []error
+	for b, err := range StdEncoding.DecodeSeq(strings.NewReader("はらぶげああ・あ")) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		got = append(got, b)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrInvalidRune) {
+		t.Errorf("DecodeSeq() errors = %v, want [%v]", errs, ErrInvalidRune)
+	}
+	if string(got) != "foo" {
+		t.Errorf("DecodeSeq() = %q, want %q", got, "foo")
+	}
+}
+
+func TestDecodeSeq_Break(t *testing.T) {
+	r := strings.NewReader(strings.Repeat(StdEncoding.EncodeToString(make([]byte, 3000)), 10))
+	count := 0
+	for range StdEncoding.DecodeSeq(r) {
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	if count != 10 {
+		t.Errorf("count = %d, want 10", count)
+	}
+	if r.Len() == 0 {
+		t.Error("DecodeSeq read all the input after break")
+	}
+}
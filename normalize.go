@@ -0,0 +1,179 @@
+package base64dq
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+// NewNormalizingReader returns a reader that reads the base64dq encoded text from r
+// and emits it in the canonical form that enc encodes to, without decoding it:
+// the ignored runes, CR, LF and the byte order mark are removed,
+// the aliases are replaced with the alphabet runes they map to,
+// the runes accepted as the padding are replaced with the padding character,
+// and the missing padding of the final block is added.
+// If enc composes kana (see WithKanaComposition), the combining marks are composed as well.
+// The text is normalized as it streams, so the whole input is never loaded in memory.
+//
+// The normalizing reader doesn't check the structure of the input,
+// e.g. the number of the alphabet runes in the final block;
+// it reports a *DecodeError for the runes that enc doesn't accept,
+// and for the alphabet runes and the padding after the padded final block
+// as Decode does.
+func NewNormalizingReader(enc *Encoding, r io.Reader) io.Reader {
+	rr, ok := r.(io.RuneReader)
+	if !ok {
+		rr = bufio.NewReader(r)
+	}
+	return &normalizer{enc: enc, m: enc.decodeMap(), r: rr}
+}
+
+type normalizer struct {
+	enc *Encoding
+	m   decodeMap
+	r   io.RuneReader
+	err error
+
+	out []byte // normalized text not yet returned
+	off int    // position of the first unread byte in out
+
+	pending    bool // whether a rune is held back for the combining mark that may follow
+	prev       rune // the rune held back
+	prevOffset int  // byte offset of prev in the input
+	prevIndex  int  // rune index of prev in the input
+
+	offset int // byte offset of the next rune in the input
+	index  int // rune index of the next rune in the input
+
+	nvals  int  // number of the alphabet runes and the padding in the current block
+	padded bool // whether the current block has the padding
+	ended  bool // whether a padded block has ended the stream
+}
+
+func (n *normalizer) Read(p []byte) (int, error) {
+	for n.off == len(n.out) {
+		if n.err != nil {
+			return 0, n.err
+		}
+		n.out, n.off = n.out[:0], 0
+		n.fill()
+	}
+	k := copy(p, n.out[n.off:])
+	n.off += k
+	return k, nil
+}
+
+// fill normalizes the input until some output is available or an error occurs.
+func (n *normalizer) fill() {
+	for len(n.out) == 0 && n.err == nil {
+		r, size, err := n.r.ReadRune()
+		if err != nil {
+			if n.pending {
+				n.pending = false
+				if n.emit() {
+					return
+				}
+			}
+			if err == io.EOF {
+				n.finish()
+			}
+			n.err = err
+			return
+		}
+		offset, index := n.offset, n.index
+		n.offset += size
+		n.index++
+
+		if r == utf8.RuneError && size == 1 {
+			if n.pending {
+				n.pending = false
+				if n.emit() {
+					return
+				}
+			}
+			if !n.enc.ignoreInvalid {
+				n.err = &DecodeError{ByteOffset: offset, RuneIndex: index, Rune: utf8.RuneError, Err: ErrInvalidUTF8}
+			}
+			continue
+		}
+		if n.pending && n.enc.compose && (r == voicedMark || r == semiVoicedMark) {
+			if c, ok := composedKana[[2]rune{n.prev, r}]; ok {
+				n.prev = c
+				continue
+			}
+		}
+		if n.pending && n.emit() {
+			return
+		}
+		n.pending, n.prev, n.prevOffset, n.prevIndex = true, r, offset, index
+	}
+}
+
+// emit writes the normalized form of the rune held back to the output.
+// It reports whether an error occurred.
+func (n *normalizer) emit() bool {
+	r := n.prev
+	if r == '\uFEFF' && n.prevOffset == 0 && n.enc.skipBOM {
+		return false
+	}
+	v, ok := n.m.search(r)
+	if !ok {
+		if n.enc.ignoreInvalid {
+			return false
+		}
+		return n.fail(ErrInvalidRune)
+	}
+	switch v {
+	case rootNode:
+		return false
+	case paddingNode:
+		if n.ended {
+			// only the ignored runes and the next stream can follow the padded block, as Decode.
+			if n.enc.concat {
+				return n.fail(ErrBadPadding)
+			}
+			return n.fail(ErrTrailingGarbage)
+		}
+		n.out = append(n.out, n.enc.padBytes...)
+		n.padded = true
+		if n.enc.singlePad && n.nvals == 2 {
+			// the single padding completes the block of two alphabet runes.
+			n.nvals++
+		}
+	default:
+		if n.ended {
+			if !n.enc.concat {
+				return n.fail(ErrTrailingGarbage)
+			}
+			// start the next stream.
+			n.ended = false
+		}
+		n.out = append(n.out, n.enc.encode[v]...)
+	}
+	n.nvals++
+	if n.nvals == 4 {
+		n.ended = n.padded
+		n.nvals, n.padded = 0, false
+	}
+	return false
+}
+
+// fail reports err at the rune held back. It always returns true.
+func (n *normalizer) fail(err error) bool {
+	n.err = &DecodeError{ByteOffset: n.prevOffset, RuneIndex: n.prevIndex, Rune: n.prev, Err: err}
+	return true
+}
+
+// finish adds the missing padding of the final block.
+func (n *normalizer) finish() {
+	if n.enc.padChar == NoPadding || n.nvals < 2 {
+		return
+	}
+	for ; n.nvals < 4; n.nvals++ {
+		n.out = append(n.out, n.enc.padBytes...)
+		if n.enc.singlePad {
+			break
+		}
+	}
+	n.nvals, n.padded = 0, false
+}
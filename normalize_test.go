@@ -0,0 +1,93 @@
+package base64dq
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+func TestNormalizingReader(t *testing.T) {
+	aliased := StdEncoding.WithAliases(map[rune]rune{'ア': 'あ'}).WithIgnoredRunes('　').WithDecodePadding('＝')
+	tests := []struct {
+		enc   *Encoding
+		input string
+		want  string
+	}{
+		{StdEncoding, "", ""},
+		{StdEncoding, "はむらあ", "はむらあ"},
+		{StdEncoding, "はむ\r\nらあ\n", "はむらあ"},
+		{StdEncoding, "はむ・・", "はむ・・"},
+		{StdEncoding, "はむ", "はむ・・"},
+		{StdEncoding, "はむら", "はむら・"},
+		{StdEncoding, "はむら\n・\n", "はむら・"},
+		{RawStdEncoding, "はむ", "はむ"},
+		{aliased, "アアアア", "ああああ"},
+		{aliased, "はむ　ら＝", "はむら・"},
+		{StdEncoding.WithSkipBOM(), "\uFEFFはむらあ", "はむらあ"},
+		{StdEncoding.WithKanaComposition(), "は\u3099むらほ\u3099", "ばむらぼ"},
+		{StdEncoding.WithKanaComposition(), "はむら", "はむら・"},
+		{StdEncoding.WithIgnoreInvalid(), "は！む\xffらあ", "はむらあ"},
+		{StdEncoding.WithConcatenated(), "はむ・・はむ", "はむ・・はむ・・"},
+	}
+	for _, tt := range tests {
+		for _, r := range []io.Reader{strings.NewReader(tt.input), iotest.OneByteReader(strings.NewReader(tt.input))} {
+			got, err := io.ReadAll(NewNormalizingReader(tt.enc, r))
+			if err != nil || string(got) != tt.want {
+				t.Errorf("NormalizingReader(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		}
+	}
+
+	// the normalized text decodes to the same data.
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			encoded := tt.conv(p.encoded)
+			got, err := io.ReadAll(NewNormalizingReader(tt.enc, iotest.HalfReader(strings.NewReader(encoded))))
+			if err != nil || string(got) != encoded {
+				t.Errorf("NormalizingReader(%q) = %q, %v, want %q", encoded, got, err, encoded)
+			}
+			var wrapped strings.Builder
+			for _, r := range encoded {
+				wrapped.WriteRune(r)
+				wrapped.WriteString("\r\n")
+			}
+			got, err = io.ReadAll(NewNormalizingReader(tt.enc, strings.NewReader(wrapped.String())))
+			if err != nil || string(got) != encoded {
+				t.Errorf("NormalizingReader(%q) = %q, %v, want %q", wrapped.String(), got, err, encoded)
+			}
+		}
+	}
+}
+
+func TestNormalizingReader_Error(t *testing.T) {
+	tests := []struct {
+		enc   *Encoding
+		input string
+		want  DecodeError
+	}{
+		{StdEncoding, "はむ！あ", DecodeError{ByteOffset: len("はむ"), RuneIndex: 2, Rune: '！', Err: ErrInvalidRune}},
+		{StdEncoding, "はむ\xffあ", DecodeError{ByteOffset: len("はむ"), RuneIndex: 2, Rune: utf8.RuneError, Err: ErrInvalidUTF8}},
+		{StdEncoding, "は\u3099", DecodeError{ByteOffset: len("は"), RuneIndex: 1, Rune: '\u3099', Err: ErrInvalidRune}},
+		{StdEncoding, "はむ・・は", DecodeError{ByteOffset: len("はむ・・"), RuneIndex: 4, Rune: 'は', Err: ErrTrailingGarbage}},
+		{StdEncoding.WithConcatenated(), "はむ・・・", DecodeError{ByteOffset: len("はむ・・"), RuneIndex: 4, Rune: '・', Err: ErrBadPadding}},
+		{StdEncoding.WithSinglePadding(), "のち・・", DecodeError{ByteOffset: len("のち・"), RuneIndex: 3, Rune: '・', Err: ErrTrailingGarbage}},
+	}
+	for _, tt := range tests {
+		got, err := io.ReadAll(NewNormalizingReader(tt.enc, strings.NewReader(tt.input)))
+		var e *DecodeError
+		if !errors.As(err, &e) || *e != tt.want {
+			t.Errorf("NormalizingReader(%q) error = %#v, want %#v", tt.input, err, tt.want)
+		}
+		if want := tt.input[:tt.want.ByteOffset]; string(got) != want {
+			t.Errorf("NormalizingReader(%q) = %q, want %q", tt.input, got, want)
+		}
+
+		// Decode rejects the same input.
+		if _, err := tt.enc.DecodeString(tt.input); !errors.Is(err, tt.want.Err) {
+			t.Errorf("DecodeString(%q) error = %v, want %v", tt.input, err, tt.want.Err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package base64dq
+
+import (
+	"io"
+	"sync"
+)
+
+// EncoderPool is a pool of stream encoders that share an Encoding.
+// It is safe for concurrent use by multiple goroutines.
+type EncoderPool struct {
+	enc  *Encoding
+	pool sync.Pool
+}
+
+// NewEncoderPool returns a new EncoderPool for enc.
+func NewEncoderPool(enc *Encoding) *EncoderPool {
+	return &EncoderPool{enc: enc}
+}
+
+// Get returns a stream encoder that writes to w.
+// Closing the encoder returns it to the pool,
+// so it must not be used after Close.
+func (p *EncoderPool) Get(w io.Writer) io.WriteCloser {
+	if p.enc.checksum != nil {
+		// the encoder with the checksum is not pooled.
+		return NewEncoder(p.enc, w)
+	}
+	e, ok := p.pool.Get().(*encoder)
+	if !ok {
+		e = &encoder{enc: p.enc, out: make([]byte, encodeBufSize)}
+	}
+	e.Reset(w)
+	e.pool = p
+	return e
+}
@@ -0,0 +1,45 @@
+package base64dq
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEncoderPool(t *testing.T) {
+	pool := NewEncoderPool(StdEncoding)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, p := range pairs {
+				bb := &strings.Builder{}
+				encoder := pool.Get(bb)
+				if _, err := encoder.Write([]byte(p.decoded)); err != nil {
+					t.Errorf("Encoder.Write(%q) error: %v", p.decoded, err)
+				}
+				if err := encoder.Close(); err != nil {
+					t.Error("Encoder.Close() error:", err)
+				}
+				if bb.String() != p.encoded {
+					t.Errorf("Encode(%q) = %q, want %q", p.decoded, bb.String(), p.encoded)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkEncoderPool(b *testing.B) {
+	pool := NewEncoderPool(StdEncoding)
+	data := []byte("foobar")
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		encoder := pool.Get(io.Discard)
+		encoder.Write(data)
+		encoder.Close()
+	}
+}
@@ -0,0 +1,15 @@
+package base64dq
+
+import "io"
+
+// RandomString reads nBytes random bytes from r, e.g. crypto/rand.Reader,
+// and returns them encoded with enc.
+// The result is always a valid string that decodes back to nBytes bytes.
+// If r returns fewer than nBytes bytes, RandomString returns the error from io.ReadFull.
+func (enc *Encoding) RandomString(r io.Reader, nBytes int) (string, error) {
+	buf := make([]byte, nBytes)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return enc.EncodeToString(buf), nil
+}
@@ -0,0 +1,51 @@
+package base64dq
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRandomString(t *testing.T) {
+	// OneByteReader returns short reads.
+	r := iotest.OneByteReader(strings.NewReader("foobar"))
+	s, err := StdEncoding.RandomString(r, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "はらぶげ" {
+		t.Errorf("RandomString() = %q, want %q", s, "はらぶげ")
+	}
+
+	for _, enc := range []*Encoding{StdEncoding, RawNameEncoding, HankakuKatakanaEncoding} {
+		for n := 0; n < 10; n++ {
+			s, err := enc.RandomString(rand.Reader, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := enc.DecodeString(s)
+			if err != nil {
+				t.Errorf("DecodeString(%q) = %v", s, err)
+			}
+			if len(decoded) != n {
+				t.Errorf("len(DecodeString(%q)) = %d, want %d", s, len(decoded), n)
+			}
+		}
+	}
+}
+
+func TestRandomString_Error(t *testing.T) {
+	_, err := StdEncoding.RandomString(strings.NewReader("fo"), 3)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("want io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	errRead := errors.New("read error")
+	_, err = StdEncoding.RandomString(iotest.ErrReader(errRead), 3)
+	if !errors.Is(err, errRead) {
+		t.Errorf("want %v, got %v", errRead, err)
+	}
+}
@@ -0,0 +1,368 @@
+package base64dq
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// decodeEntry is a rune accepted by the decoder.
+type decodeEntry struct {
+	r rune
+	v int // index in the alphabet, paddingNode, or rootNode for ignored runes
+}
+
+// decodeMap is a table of the runes accepted by the decoder, sorted by rune.
+// It is much smaller than the DFA, but slower to look up.
+type decodeMap []decodeEntry
+
+func newDecodeMap(enc *Encoding) decodeMap {
+	m := make(decodeMap, 0, 64+len(enc.aliases)+2+len(enc.ignore)+1+len(enc.decodePad))
+	for i, s := range enc.encode {
+		r, _ := utf8.DecodeRuneInString(s)
+		m = append(m, decodeEntry{r: r, v: i})
+	}
+	for alias, r := range enc.aliases {
+		m = append(m, decodeEntry{r: alias, v: enc.index(r)})
+	}
+	for _, r := range enc.ignoredRunes() {
+		m = append(m, decodeEntry{r: r, v: rootNode})
+	}
+	if enc.padChar != NoPadding {
+		m = append(m, decodeEntry{r: enc.padChar, v: paddingNode})
+		for _, r := range enc.decodePad {
+			m = append(m, decodeEntry{r: r, v: paddingNode})
+		}
+	}
+	sort.Slice(m, func(i, j int) bool { return m[i].r < m[j].r })
+	return m
+}
+
+// search returns the value of r.
+func (m decodeMap) search(r rune) (int, bool) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].r >= r })
+	if i < len(m) && m[i].r == r {
+		return m[i].v, true
+	}
+	return 0, false
+}
+
+func (enc *Encoding) decodeMap() decodeMap {
+	enc.dmapOnce.Do(func() {
+		enc.dmap = newDecodeMap(enc)
+	})
+	return enc.dmap
+}
+
+// DecodeRunewise is like Decode but looks up each rune in a sorted table
+// instead of the DFA that Decode uses.
+// It is slower than Decode, but never builds the DFA,
+// so it is suitable for memory-constrained environments.
+// It returns the same results and errors as Decode.
+func (enc *Encoding) DecodeRunewise(dst, src []byte) (int, error) {
+	if enc.compose && hasCombiningMark(src) {
+		src = composeKana(append([]byte(nil), src...), nil)
+	}
+	if enc.ignoreInvalid {
+		src = enc.dropInvalid(append([]byte(nil), src...), nil)
+	}
+	if enc.constantTime {
+		return decodeConstantTime(enc, dst, src, true)
+	}
+	return decodeRunewise(enc, dst, utf8Source(src))
+}
+
+// DecodeRunes is like DecodeRunewise but decodes the runes in src directly,
+// without encoding them into UTF-8.
+// It returns the same results as Decode of the UTF-8 encoding of src,
+// except that the errors report the positions in src:
+// the RuneIndex of the *DecodeError is the index in src,
+// and its ByteOffset is the offset in the UTF-8 encoding of src.
+// The invalid rune values in src are reported as ErrInvalidRune.
+func (enc *Encoding) DecodeRunes(dst []byte, src []rune) (int, error) {
+	if enc.compose {
+		src = composeKanaRunes(append([]rune(nil), src...))
+	}
+	if enc.ignoreInvalid {
+		src = enc.dropInvalidRunes(append([]rune(nil), src...))
+	}
+	if enc.constantTime {
+		return decodeConstantTime(enc, dst, []byte(string(src)), true)
+	}
+	return decodeRunewise(enc, dst, runeSource(src))
+}
+
+// runeInput is the input of the rune-level decoders.
+// The positions in the input are byte offsets for utf8Source,
+// and rune indexes for runeSource.
+type runeInput interface {
+	utf8Source | runeSource
+
+	// bomLen returns the length of the byte order mark that enc skips at the start.
+	bomLen(enc *Encoding) int
+
+	// next returns the rune at i and the position after it.
+	// ok is false if the input at i is malformed.
+	next(i int) (r rune, end int, ok bool)
+
+	// errorAt returns a *DecodeError at i.
+	errorAt(i int, err error) error
+
+	// invalidError returns the error for the rune at i that the decoder rejects,
+	// where lastRune is the position after the last rune that contributed to the output.
+	// If padded is true, only the padding and the ignored runes can follow.
+	invalidError(m decodeMap, i, lastRune int, padded bool) error
+}
+
+// utf8Source is the UTF-8 encoded input.
+type utf8Source []byte
+
+func (s utf8Source) bomLen(enc *Encoding) int {
+	return bomLen(enc, []byte(s))
+}
+
+func (s utf8Source) next(i int) (rune, int, bool) {
+	r, size := utf8.DecodeRune(s[i:])
+	return r, i + size, r != utf8.RuneError || size > 1
+}
+
+func (s utf8Source) errorAt(i int, err error) error {
+	return newDecodeError([]byte(s), i, err)
+}
+
+func (s utf8Source) invalidError(m decodeMap, i, lastRune int, padded bool) error {
+	if invalidUTF8([]byte(s[i:])) {
+		return s.errorAt(i, ErrInvalidUTF8)
+	}
+	return s.errorAt(lastRune, ErrInvalidRune)
+}
+
+// runeSource is the input decoded into runes.
+type runeSource []rune
+
+func (s runeSource) bomLen(enc *Encoding) int {
+	if enc.skipBOM && len(s) > 0 && s[0] == '\uFEFF' {
+		return 1
+	}
+	return 0
+}
+
+func (s runeSource) next(i int) (rune, int, bool) {
+	return s[i], i + 1, true
+}
+
+// errorAt returns a *DecodeError at s[i].
+// The ByteOffset counts the invalid rune values as utf8.RuneError, as string(s) does.
+func (s runeSource) errorAt(i int, err error) error {
+	e := &DecodeError{
+		RuneIndex: i,
+		Rune:      -1,
+		Err:       err,
+	}
+	for _, r := range s[:i] {
+		n := utf8.RuneLen(r)
+		if n < 0 {
+			n = len(string(utf8.RuneError))
+		}
+		e.ByteOffset += n
+	}
+	if i < len(s) {
+		e.Rune = s[i]
+	}
+	return e
+}
+
+func (s runeSource) invalidError(m decodeMap, i, lastRune int, padded bool) error {
+	return s.errorAt(lastRune, ErrInvalidRune)
+}
+
+// dropInvalidRunes is dropInvalid for a rune slice.
+func (enc *Encoding) dropInvalidRunes(src []rune) []rune {
+	m := enc.decodeMap()
+	j := 0
+	for _, r := range src {
+		if _, ok := m.search(r); ok {
+			src[j] = r
+			j++
+		}
+	}
+	return src[:j]
+}
+
+// decodeRunewise is the decoder of DecodeRunewise and DecodeRunes.
+func decodeRunewise[S runeInput](enc *Encoding, dst []byte, src S) (int, error) {
+	// Decode quantum using the base64 alphabet
+	var dbuf [4]byte
+
+	m := enc.decodeMap()
+	i := src.bomLen(enc)
+	padCount := 0
+	lastBlock := i // position of last block boundary
+	lastRune := i  // position of last rune that contributed to the output
+	j := 0
+	k := 0
+
+LOOP:
+	for i < len(src) {
+		r, end, valid := src.next(i)
+		v, ok := m.search(r)
+		if !valid {
+			ok = false
+		}
+		if padCount > 0 && v != paddingNode && v != rootNode {
+			// only the padding and the ignored runes can follow the padding.
+			ok = false
+		}
+		if !ok {
+			return 0, src.invalidError(m, i, lastRune, padCount > 0)
+		}
+		i = end
+
+		if v == rootNode {
+			continue
+		}
+		isPadding := v == paddingNode
+		if isPadding {
+			switch j % 4 {
+			case 0, 1:
+				// incorrect padding
+				return 0, src.errorAt(lastRune, ErrBadPadding)
+			}
+			padCount++
+			v = 0
+			if enc.singlePad && j%4 == 2 {
+				// the single padding completes the block of two alphabet runes.
+				dbuf[2] = 0
+				j++
+				padCount++
+			}
+		}
+
+		dbuf[j%4] = byte(v)
+		j++
+		if j%4 == 0 {
+			lastBlock = i
+			// Convert 4x 6bit source bytes into 3 bytes
+			val := uint(dbuf[0])<<18 | uint(dbuf[1])<<12 | uint(dbuf[2])<<6 | uint(dbuf[3])
+			switch padCount {
+			case 0:
+				if len(dst)-k < 3 {
+					return 0, ErrShortBuffer
+				}
+				dst[k+0] = byte(val >> 16)
+				dst[k+1] = byte(val >> 8)
+				dst[k+2] = byte(val >> 0)
+				k += 3
+			case 1:
+				if len(dst)-k < 2 {
+					return 0, ErrShortBuffer
+				}
+				dst[k+0] = byte(val >> 16)
+				dst[k+1] = byte(val >> 8)
+				if enc.strict && (val&0xFF) != 0 {
+					return 0, src.errorAt(lastRune, ErrTrailingBits)
+				}
+				k += 2
+				if enc.concat {
+					// start the next stream.
+					padCount, lastRune = 0, i
+					continue
+				}
+				break LOOP
+			case 2:
+				if len(dst)-k < 1 {
+					return 0, ErrShortBuffer
+				}
+				dst[k+0] = byte(val >> 16)
+				if enc.strict && (val&0xFFFF) != 0 {
+					return 0, src.errorAt(lastRune, ErrTrailingBits)
+				}
+				k += 1
+				if enc.concat {
+					// start the next stream.
+					padCount, lastRune = 0, i
+					continue
+				}
+				break LOOP
+			case 3, 4:
+				return 0, src.errorAt(lastRune, ErrBadPadding)
+			}
+		}
+		if !isPadding {
+			lastRune = i
+		}
+	}
+
+	// handle remaining bytes and padding
+	if j%4 != 0 {
+		if enc.padChar != NoPadding {
+			if padCount == 0 {
+				return 0, src.errorAt(lastBlock, ErrTruncated)
+			}
+			return 0, src.errorAt(i, ErrTruncated)
+		}
+
+		// Convert 4x 6bit source bytes into 3 bytes
+		for i := j % 4; i < 4; i++ {
+			dbuf[i] = 0
+		}
+		val := uint(dbuf[0])<<18 | uint(dbuf[1])<<12 | uint(dbuf[2])<<6 | uint(dbuf[3])
+		switch j % 4 {
+		case 0, 1:
+			return 0, src.errorAt(i, ErrTruncated)
+		case 2:
+			if len(dst)-k < 1 {
+				return 0, ErrShortBuffer
+			}
+			dst[k+0] = byte(val >> 16)
+			if enc.strict && (val&0xFFFF) != 0 {
+				return 0, src.errorAt(lastRune, ErrTrailingBits)
+			}
+			k += 1
+		case 3:
+			if len(dst)-k < 2 {
+				return 0, ErrShortBuffer
+			}
+			dst[k+0] = byte(val >> 16)
+			dst[k+1] = byte(val >> 8)
+			if enc.strict && (val&0xFF) != 0 {
+				return 0, src.errorAt(lastRune, ErrTrailingBits)
+			}
+			k += 2
+		}
+	}
+
+	// only ignored runes are allowed after the final block.
+	for i < len(src) {
+		r, end, valid := src.next(i)
+		if v, ok := m.search(r); !ok || v != rootNode || !valid {
+			// trailing garbage
+			return 0, src.errorAt(i, ErrTrailingGarbage)
+		}
+		i = end
+	}
+
+	if enc.checksum != nil {
+		return enc.verifyChecksum(dst[:k])
+	}
+	return k, nil
+}
+
+// DecodeRune returns the 6-bit value of the alphabet rune r.
+// ok is false if r is not in the alphabet, including the padding and the ignored runes.
+// The aliases of the alphabet runes are decoded as the runes they map to.
+func (enc *Encoding) DecodeRune(r rune) (val byte, ok bool) {
+	v, ok := enc.decodeMap().search(r)
+	if !ok || v < 0 || v >= 64 {
+		return 0, false
+	}
+	return byte(v), true
+}
+
+// EncodeValue returns the alphabet rune for the 6-bit value v.
+// ok is false if v is not less than 64.
+func (enc *Encoding) EncodeValue(v byte) (s string, ok bool) {
+	if v >= 64 {
+		return "", false
+	}
+	return enc.encode[v], true
+}
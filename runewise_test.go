@@ -0,0 +1,177 @@
+package base64dq
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDecodeRunewise(t *testing.T) {
+	check := func(enc *Encoding, input string) {
+		t.Helper()
+		dbuf := make([]byte, enc.DecodedLen(len(input)))
+		n, err := enc.Decode(dbuf, []byte(input))
+		want := fmt.Sprintf("%q %v", dbuf[:n], err)
+
+		dbuf = make([]byte, enc.DecodedLen(len(input)))
+		n, err = enc.DecodeRunewise(dbuf, []byte(input))
+		got := fmt.Sprintf("%q %v", dbuf[:n], err)
+		if got != want {
+			t.Errorf("DecodeRunewise(%q) = %s, want %s", input, got, want)
+		}
+	}
+
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			check(tt.enc, tt.conv(p.encoded))
+		}
+	}
+	for _, tc := range decodeCorruptTestCases {
+		check(StdEncoding, tc.input)
+		check(StdEncoding.Strict(), tc.input)
+		check(RawStdEncoding, tc.input)
+	}
+
+	enc := StdEncoding.WithIgnoredRunes('　').WithAliases(map[rune]rune{'ア': 'あ'})
+	for _, input := range []string{
+		"はむ・・　", "はむ　・・", "はむ・　・", "アアアア", "はむ・・\xe3\x80", "はむ\xe3\x80",
+		"はむ・ア", "はむ・・ア", "ああ\xe3\x81", "ああ\xe3\x81あ", "ああ・\xe3\x83", "ああ・\xe3\x80",
+	} {
+		check(enc, input)
+	}
+}
+
+func TestDecodeRunewise_NoDFA(t *testing.T) {
+	enc := NewEncoding(encodeStd)
+	dbuf := make([]byte, 3)
+	if _, err := enc.DecodeRunewise(dbuf, []byte("はむらあ")); err != nil {
+		t.Fatal(err)
+	}
+	if enc.dfa.root != nil {
+		t.Error("DecodeRunewise built the DFA")
+	}
+}
+
+func TestDecodeRunewise_ShortBuffer(t *testing.T) {
+	for _, p := range pairs {
+		for size := 0; size < len(p.decoded); size++ {
+			dbuf := make([]byte, size)
+			n, err := StdEncoding.DecodeRunewise(dbuf, []byte(p.encoded))
+			if err != ErrShortBuffer {
+				t.Errorf("DecodeRunewise(%q) into %d bytes = %d, %v, want %v", p.encoded, size, n, err, ErrShortBuffer)
+			}
+		}
+	}
+}
+
+func TestDecodeRunes(t *testing.T) {
+	check := func(enc *Encoding, input string) {
+		t.Helper()
+		dbuf := make([]byte, enc.DecodedLen(len(input)))
+		n, err := enc.Decode(dbuf, []byte(input))
+		want := fmt.Sprintf("%q %v", dbuf[:n], err)
+
+		dbuf = make([]byte, enc.DecodedLen(len(input)))
+		n, err = enc.DecodeRunes(dbuf, []rune(input))
+		got := fmt.Sprintf("%q %v", dbuf[:n], err)
+		if got != want {
+			t.Errorf("DecodeRunes(%q) = %s, want %s", input, got, want)
+		}
+	}
+
+	for _, p := range pairs {
+		for _, tt := range encodingTests {
+			check(tt.enc, tt.conv(p.encoded))
+		}
+	}
+	for _, tc := range decodeCorruptTestCases {
+		if !utf8.ValidString(tc.input) {
+			continue
+		}
+		check(StdEncoding, tc.input)
+		check(StdEncoding.Strict(), tc.input)
+		check(RawStdEncoding, tc.input)
+		check(StdEncoding.Strict().WithConstantTime(), tc.input)
+		check(RawStdEncoding.WithConstantTime(), tc.input)
+	}
+
+	enc := StdEncoding.WithIgnoredRunes('　').WithAliases(map[rune]rune{'ア': 'あ'})
+	for _, input := range []string{
+		"はむ・・　", "はむ　・・", "はむ・　・", "アアアア", "はむ・ア", "はむ・・ア",
+	} {
+		check(enc, input)
+	}
+	check(StdEncoding.WithKanaComposition(), "は\u3099む\u309aらあ")
+	check(StdEncoding.WithKanaComposition(), "\u3099は\u3099\u3099らあ")
+	check(StdEncoding.WithSkipBOM(), "\ufeffはむらあ")
+	check(StdEncoding.WithIgnoreInvalid(), "は！むらあ！")
+	check(StdEncoding.WithConcatenated(), "はむ・・はむ・・")
+	check(StdEncoding.WithChecksum(xorSum), "はむらあはむ・・")
+
+	// the errors report the index in src.
+	for _, tc := range decodeCorruptTestCases {
+		if tc.offset == -1 || !utf8.ValidString(tc.input) {
+			continue
+		}
+		for _, enc := range []*Encoding{StdEncoding, StdEncoding.WithConstantTime()} {
+			_, err := enc.DecodeRunes(make([]byte, len(tc.input)), []rune(tc.input))
+			var got *DecodeError
+			if !errors.As(err, &got) {
+				t.Errorf("%v: DecodeRunes(%q) error = %v, want DecodeError", enc, tc.input, err)
+				continue
+			}
+			if want := utf8.RuneCountInString(tc.input[:tc.offset]); got.RuneIndex != want || got.ByteOffset != tc.offset {
+				t.Errorf("%v: DecodeRunes(%q) error at %d (byte %d), want %d (byte %d)", enc, tc.input, got.RuneIndex, got.ByteOffset, want, tc.offset)
+			}
+		}
+	}
+
+	// invalid rune values are invalid runes.
+	for _, enc := range []*Encoding{StdEncoding, StdEncoding.WithConstantTime()} {
+		_, err := enc.DecodeRunes(make([]byte, 3), []rune{'は', -1, 'ら', 'あ'})
+		var got *DecodeError
+		if !errors.As(err, &got) || got.RuneIndex != 1 || got.Err != ErrInvalidRune {
+			t.Errorf("%v: DecodeRunes with an invalid rune value: error = %#v", enc, err)
+		}
+	}
+}
+
+func TestDecodeRune(t *testing.T) {
+	enc := StdEncoding.WithIgnoredRunes(' ').WithAliases(map[rune]rune{'ア': 'あ'})
+	for _, tt := range []struct {
+		r   rune
+		val byte
+		ok  bool
+	}{
+		{'あ', 0, true},
+		{'ぼ', 63, true},
+		{'ア', 0, true},
+		{'・', 0, false},
+		{' ', 0, false},
+		{'\n', 0, false},
+		{'A', 0, false},
+		{utf8.RuneError, 0, false},
+	} {
+		val, ok := enc.DecodeRune(tt.r)
+		if val != tt.val || ok != tt.ok {
+			t.Errorf("DecodeRune(%q) = %d, %t, want %d, %t", tt.r, val, ok, tt.val, tt.ok)
+		}
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	for v := 0; v < 64; v++ {
+		s, ok := StdEncoding.EncodeValue(byte(v))
+		if !ok {
+			t.Errorf("EncodeValue(%d) is not ok", v)
+		}
+		r, _ := utf8.DecodeRuneInString(s)
+		if val, ok := StdEncoding.DecodeRune(r); !ok || val != byte(v) {
+			t.Errorf("DecodeRune(%q) = %d, %t, want %d, true", r, val, ok, v)
+		}
+	}
+	if s, ok := StdEncoding.EncodeValue(64); ok {
+		t.Errorf("EncodeValue(64) = %q, want not ok", s)
+	}
+}
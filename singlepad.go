@@ -0,0 +1,19 @@
+package base64dq
+
+// WithSinglePadding creates a new encoding identical to enc except
+// that a single padding character ends any partial final block.
+// The encoder emits "xx・" instead of "xx・・" for a final block of one byte,
+// and "xxx・" for a final block of two bytes as usual,
+// so the decoder infers the length of the final block from the number of the alphabet runes before the padding.
+// The decoder rejects the second padding character of "xx・・" as ErrTrailingGarbage.
+//
+// It panics if enc has no padding.
+func (enc *Encoding) WithSinglePadding() *Encoding {
+	if enc.padChar == NoPadding {
+		panic("single padding on the encoding without padding")
+	}
+	e := enc.Clone()
+	e.singlePad = true
+	e.dfa = enc.dfa // the padding is counted by the decoder, not by the DFA.
+	return e
+}
@@ -0,0 +1,124 @@
+package base64dq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+func TestWithSinglePadding(t *testing.T) {
+	enc := StdEncoding.WithSinglePadding()
+	for _, p := range pairs {
+		want := strings.Replace(p.encoded, "・・", "・", 1)
+		got := enc.EncodeToString([]byte(p.decoded))
+		if got != want {
+			t.Errorf("EncodeToString(%q) = %q, want %q", p.decoded, got, want)
+		}
+		if n := enc.EncodedRuneLen(len(p.decoded)); n != utf8.RuneCountInString(want) {
+			t.Errorf("EncodedRuneLen(%d) = %d, want %d", len(p.decoded), n, utf8.RuneCountInString(want))
+		}
+		if n := enc.EncodedLenExact([]byte(p.decoded)); n != len(want) {
+			t.Errorf("EncodedLenExact(%q) = %d, want %d", p.decoded, n, len(want))
+		}
+
+		decoders := map[string]func() ([]byte, error){
+			"Decode": func() ([]byte, error) {
+				return enc.DecodeString(want)
+			},
+			"DecodeRunewise": func() ([]byte, error) {
+				dst := make([]byte, enc.DecodedLen(len(want)))
+				n, err := enc.DecodeRunewise(dst, []byte(want))
+				return dst[:n], err
+			},
+			"DecodeRunes": func() ([]byte, error) {
+				dst := make([]byte, enc.DecodedLen(len(want)))
+				n, err := enc.DecodeRunes(dst, []rune(want))
+				return dst[:n], err
+			},
+			"DecodeConstantTime": func() ([]byte, error) {
+				return enc.WithConstantTime().DecodeString(want)
+			},
+			"Decoder": func() ([]byte, error) {
+				return io.ReadAll(NewDecoder(enc, iotest.OneByteReader(strings.NewReader(want))))
+			},
+		}
+		for name, decode := range decoders {
+			got, err := decode()
+			if err != nil || string(got) != p.decoded {
+				t.Errorf("%s(%q) = %q, %v, want %q", name, want, got, err, p.decoded)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		input  string
+		offset int
+		err    error
+	}{
+		{"はむ・・", len("はむ・"), ErrTrailingGarbage},
+		{"はむ", 0, ErrTruncated},
+		{"は・", len("は"), ErrBadPadding},
+	} {
+		_, err := enc.DecodeString(tt.input)
+		var e *DecodeError
+		if !errors.As(err, &e) || e.ByteOffset != tt.offset || e.Err != tt.err {
+			t.Errorf("DecodeString(%q) error = %v, want %v at %d", tt.input, err, tt.err, tt.offset)
+		}
+	}
+}
+
+func TestWithSinglePadding_DecodeN(t *testing.T) {
+	enc := StdEncoding.WithSinglePadding()
+	src := []byte("はむ・はらぶげ")
+	dst := make([]byte, 1)
+	n, err := enc.DecodeN(dst, src, 1)
+	if err != nil || n != len("はむ・") || string(dst) != "f" {
+		t.Errorf("DecodeN(%q, 1) = %d, %v, %q, want %d", src, n, err, dst, len("はむ・"))
+	}
+}
+
+func TestWithSinglePadding_NoPadding(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithSinglePadding on RawStdEncoding didn't panic")
+		}
+	}()
+	RawStdEncoding.WithSinglePadding()
+}
+
+func TestWithSinglePadding_Interop(t *testing.T) {
+	enc := StdEncoding.WithSinglePadding()
+	if enc.Equal(StdEncoding) {
+		t.Error("single padding encoding equals StdEncoding")
+	}
+	if !enc.WithPadding(NoPadding).Equal(RawStdEncoding) {
+		t.Error("WithPadding(NoPadding) kept the single padding")
+	}
+
+	for _, tt := range []struct {
+		dst, src *Encoding
+		input    string
+		want     string
+	}{
+		{enc, StdEncoding, "はむ・・", "はむ・"},
+		{StdEncoding, enc, "はむ・", "はむ・・"},
+		{enc, RawStdEncoding, "はむ", "はむ・"},
+		{enc, StdEncoding, "はむら・", "はむら・"},
+	} {
+		got, err := Transcode(tt.dst, tt.src, tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("Transcode(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+
+	for input, want := range map[string]string{"はむ": "はむ・", "はむ・": "はむ・", "はむら": "はむら・"} {
+		got, err := io.ReadAll(NewNormalizingReader(enc, strings.NewReader(input)))
+		if fmt.Sprintf("%s %v", got, err) != want+" <nil>" {
+			t.Errorf("NormalizingReader(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+}
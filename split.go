@@ -0,0 +1,28 @@
+package base64dq
+
+import (
+	"bufio"
+	"unicode/utf8"
+)
+
+// SplitFunc returns a split function for a bufio.Scanner
+// that returns each alphabet rune or padding rune of enc as a token.
+// The other runes, including CR and LF, are skipped,
+// so the scanner can extract the base64dq data interleaved with other text.
+func (enc *Encoding) SplitFunc() bufio.SplitFunc {
+	m := enc.decodeMap()
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		for i := 0; i < len(data); {
+			if !atEOF && !utf8.FullRune(data[i:]) {
+				// the rune may continue in the next chunk.
+				return i, nil, nil
+			}
+			r, size := utf8.DecodeRune(data[i:])
+			if v, ok := m.search(r); ok && v != rootNode && (r != utf8.RuneError || size > 1) {
+				return i + size, data[i : i+size], nil
+			}
+			i += size
+		}
+		return len(data), nil, nil
+	}
+}
@@ -0,0 +1,38 @@
+package base64dq
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSplitFunc(t *testing.T) {
+	input := "ふっかつのじゅもん: はらぶげ\r\nのら・・ ok"
+	want := []string{"ふ", "か", "つ", "の", "じ", "も", "は", "ら", "ぶ", "げ", "の", "ら", "・", "・"}
+	for _, tt := range []struct {
+		name string
+		enc  *Encoding
+		want []string
+	}{
+		{"std", StdEncoding, want},
+		{"raw", RawStdEncoding, []string{"ふ", "か", "つ", "の", "じ", "も", "は", "ら", "ぶ", "げ", "の", "ら"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// one byte reader splits multi-byte runes across buffer refills.
+			s := bufio.NewScanner(iotest.OneByteReader(strings.NewReader(input)))
+			s.Buffer(make([]byte, 2), 4)
+			s.Split(tt.enc.SplitFunc())
+			var got []string
+			for s.Scan() {
+				got = append(got, s.Text())
+			}
+			if err := s.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("tokens = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
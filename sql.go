@@ -0,0 +1,39 @@
+package base64dq
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Value implements driver.Valuer.
+// It returns the encoded string, or nil (SQL NULL) if b.Data is nil.
+func (b EncodedBytes) Value() (driver.Value, error) {
+	if b.Data == nil {
+		return nil, nil
+	}
+	return b.encoding().EncodeToString(b.Data), nil
+}
+
+// Scan implements sql.Scanner.
+// It decodes src of string or []byte, and sets b.Data to nil if src is nil (SQL NULL).
+// If src is not a valid base64dq data, b.Data is left unchanged.
+func (b *EncodedBytes) Scan(src any) error {
+	var data []byte
+	var err error
+	switch src := src.(type) {
+	case nil:
+		b.Data = nil
+		return nil
+	case string:
+		data, err = b.encoding().AppendDecode([]byte{}, []byte(src))
+	case []byte:
+		data, err = b.encoding().AppendDecode([]byte{}, src)
+	default:
+		return fmt.Errorf("base64dq: cannot scan %T into EncodedBytes", src)
+	}
+	if err != nil {
+		return err
+	}
+	b.Data = data
+	return nil
+}
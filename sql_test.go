@@ -0,0 +1,65 @@
+package base64dq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+var (
+	_ driver.Valuer = EncodedBytes{}
+	_ sql.Scanner   = (*EncodedBytes)(nil)
+)
+
+func TestEncodedBytes_Value(t *testing.T) {
+	for _, tt := range []struct {
+		b    EncodedBytes
+		want driver.Value
+	}{
+		{EncodedBytes{}, nil},
+		{EncodedBytes{Data: []byte{}}, ""},
+		{EncodedBytes{Data: []byte("foobar")}, "はらぶげのらかじ"},
+		{EncodedBytes{Enc: RawKatakanaEncoding, Data: []byte("fo")}, "ハラビ"},
+	} {
+		got, err := tt.b.Value()
+		if err != nil {
+			t.Errorf("Value() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Value() = %#v, want %#v", got, tt.want)
+		}
+	}
+}
+
+func TestEncodedBytes_Scan(t *testing.T) {
+	for _, tt := range []struct {
+		src  any
+		want []byte
+	}{
+		{nil, nil},
+		{"", []byte{}},
+		{"はらぶげのらかじ", []byte("foobar")},
+		{[]byte("はらぶげのらかじ"), []byte("foobar")},
+	} {
+		b := EncodedBytes{Data: []byte("keep")}
+		if err := b.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%#v) error = %v", tt.src, err)
+		}
+		if (b.Data == nil) != (tt.want == nil) || string(b.Data) != string(tt.want) {
+			t.Errorf("Scan(%#v) = %#v, want %#v", tt.src, b.Data, tt.want)
+		}
+	}
+
+	b := EncodedBytes{Data: []byte("keep")}
+	var cie CorruptInputError
+	if err := b.Scan("ああ・あ"); !errors.As(err, &cie) {
+		t.Errorf("Scan() error = %v, want CorruptInputError", err)
+	}
+	if err := b.Scan(42); err == nil {
+		t.Error("Scan(42) error = nil, want an error")
+	}
+	if string(b.Data) != "keep" {
+		t.Errorf("Scan() modified the value: %q", b.Data)
+	}
+}
@@ -0,0 +1,53 @@
+package base64dq
+
+// Bytes is a byte slice that is marshaled into a text by StdEncoding.
+// It implements encoding.TextMarshaler and encoding.TextUnmarshaler,
+// so it is rendered as a string in JSON, YAML, and so on.
+type Bytes []byte
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Bytes) MarshalText() ([]byte, error) {
+	return StdEncoding.AppendEncode(nil, b), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// If text is not a valid base64dq data, b is left unchanged.
+func (b *Bytes) UnmarshalText(text []byte) error {
+	data, err := StdEncoding.AppendDecode(nil, text)
+	if err != nil {
+		return err
+	}
+	*b = data
+	return nil
+}
+
+// EncodedBytes is a byte slice with the encoding to marshal it into a text.
+// It implements encoding.TextMarshaler and encoding.TextUnmarshaler,
+// and driver.Valuer and sql.Scanner to store it in a text column.
+type EncodedBytes struct {
+	Enc  *Encoding // the encoding; StdEncoding if nil
+	Data []byte
+}
+
+func (b *EncodedBytes) encoding() *Encoding {
+	if b.Enc == nil {
+		return StdEncoding
+	}
+	return b.Enc
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b EncodedBytes) MarshalText() ([]byte, error) {
+	return b.encoding().AppendEncode(nil, b.Data), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// If text is not a valid base64dq data, b.Data is left unchanged.
+func (b *EncodedBytes) UnmarshalText(text []byte) error {
+	data, err := b.encoding().AppendDecode(nil, text)
+	if err != nil {
+		return err
+	}
+	b.Data = data
+	return nil
+}
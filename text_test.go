@@ -0,0 +1,70 @@
+package base64dq
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	type record struct {
+		Password Bytes `json:"password"`
+	}
+	for _, p := range pairs {
+		data, err := json.Marshal(record{Password: Bytes(p.decoded)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(data), `{"password":"`+p.encoded+`"}`; got != want {
+			t.Errorf("Marshal(%q) = %s, want %s", p.decoded, got, want)
+		}
+
+		var r record
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		if string(r.Password) != p.decoded {
+			t.Errorf("Unmarshal(%s) = %q, want %q", data, r.Password, p.decoded)
+		}
+	}
+
+	b := Bytes("keep")
+	err := b.UnmarshalText([]byte("ああ・あ"))
+	var cie CorruptInputError
+	if !errors.As(err, &cie) || cie != CorruptInputError(len("ああ")) {
+		t.Errorf("UnmarshalText() error = %v, want CorruptInputError(%d)", err, len("ああ"))
+	}
+	if string(b) != "keep" {
+		t.Errorf("UnmarshalText() modified the value: %q", b)
+	}
+}
+
+func TestEncodedBytes(t *testing.T) {
+	for _, enc := range []*Encoding{nil, StdEncoding, RawKatakanaEncoding} {
+		in := EncodedBytes{Enc: enc, Data: []byte(bigtest.decoded)}
+		data, err := json.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantEnc := StdEncoding
+		if enc != nil {
+			wantEnc = enc
+		}
+		if got, want := string(data), `"`+wantEnc.EncodeToString(in.Data)+`"`; got != want {
+			t.Errorf("Marshal() = %s, want %s", got, want)
+		}
+
+		out := EncodedBytes{Enc: enc}
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		if string(out.Data) != bigtest.decoded {
+			t.Errorf("Unmarshal(%s) = %q, want %q", data, out.Data, bigtest.decoded)
+		}
+	}
+
+	b := EncodedBytes{Enc: KatakanaEncoding}
+	if err := b.UnmarshalText([]byte("はむ・・")); !errors.Is(err, ErrInvalidRune) {
+		t.Errorf("UnmarshalText() error = %v, want %v", err, ErrInvalidRune)
+	}
+}
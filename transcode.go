@@ -0,0 +1,118 @@
+package base64dq
+
+import "strings"
+
+// Transcode converts s, encoded with src, into the encoding dst
+// by mapping each symbol to the symbol of dst with the same 6-bit value,
+// without decoding the underlying bytes.
+//
+// The padding characters are replaced with the padding character of dst,
+// or removed if dst has no padding. If s is unpadded and dst has padding,
+// the padding is added to the final block.
+// The number of the padding characters is adjusted if either encoding has a single padding
+// (see WithSinglePadding).
+// The runes ignored by src, such as CR and LF, and the byte order mark skipped by src are copied as is.
+//
+// Transcode returns a *DecodeError if s contains a rune that src doesn't accept.
+// It doesn't check the length of s nor the trailing bits as Decode does.
+func Transcode(dst, src *Encoding, s string) (string, error) {
+	var b strings.Builder
+	b.Grow(len(s))
+	n := src.buildOnce().root
+	start := bomLen(src, s) // position of the current rune
+	count := 0              // number of symbols written
+	padded := false         // whether the padding follows the last symbol
+	b.WriteString(s[:start])
+	for i := start; i < len(s); i++ {
+		n = n.next(s[i])
+		if n == nil {
+			if invalidUTF8(s[start:]) {
+				return "", newDecodeError(s, start, ErrInvalidUTF8)
+			}
+			return "", newDecodeError(s, start, ErrInvalidRune)
+		}
+		switch v := n.v; {
+		case v == midNode:
+			continue
+		case v == paddingNode:
+			switch {
+			case dst.padChar == NoPadding, dst.singlePad && padded:
+			case src.singlePad && !dst.singlePad && count%4 == 2:
+				// the single padding stands for two.
+				b.Write(dst.padBytes)
+				b.Write(dst.padBytes)
+			default:
+				b.Write(dst.padBytes)
+			}
+			padded = true
+		case v >= 0:
+			b.WriteString(dst.encode[v])
+			count++
+			padded = false
+		default:
+			// ignored rune
+			b.WriteString(s[start : i+1])
+		}
+		start = i + 1
+	}
+	if n.v == midNode {
+		// the input ends in the middle of a rune.
+		return "", newDecodeError(s, start, ErrInvalidUTF8)
+	}
+
+	if src.padChar == NoPadding && dst.padChar != NoPadding && count%4 != 0 {
+		for i := count % 4; i < 4; i++ {
+			b.Write(dst.padBytes)
+			if dst.singlePad {
+				break
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// stdAlphabet is the alphabet of the standard base64 encoding defined in RFC 4648.
+const stdAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// ToStdReplacer returns a replacer that converts the text encoded with enc
+// into the standard base64 encoding of encoding/base64,
+// by mapping each alphabet rune to the symbol with the same 6-bit value
+// and the padding character to '='.
+// The other runes, such as CR, LF and the aliases, are left as is.
+//
+// If enc has a single padding (see WithSinglePadding),
+// the padding of a final block of one byte must be doubled by the caller.
+func (enc *Encoding) ToStdReplacer() *strings.Replacer {
+	oldnew := make([]string, 0, 2*65)
+	for i, s := range enc.encode {
+		oldnew = append(oldnew, s, stdAlphabet[i:i+1])
+	}
+	if enc.padChar != NoPadding {
+		oldnew = append(oldnew, string(enc.padBytes), "=")
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// FromStdReplacer returns a replacer that converts the text encoded with
+// the standard base64 encoding of encoding/base64 into enc.
+// It is the inverse of ToStdReplacer: each symbol is mapped to the alphabet rune
+// with the same 6-bit value, and '=' is mapped to the padding character of enc,
+// or removed if enc has no padding.
+// If enc has a single padding (see WithSinglePadding), "==" is mapped to
+// one padding character.
+func (enc *Encoding) FromStdReplacer() *strings.Replacer {
+	oldnew := make([]string, 0, 2*66)
+	for i, s := range enc.encode {
+		oldnew = append(oldnew, stdAlphabet[i:i+1], s)
+	}
+	switch {
+	case enc.padChar == NoPadding:
+		oldnew = append(oldnew, "=", "")
+	case enc.singlePad:
+		// the replacer tries the pairs in this order, so "==" wins over "=".
+		oldnew = append(oldnew, "==", string(enc.padBytes), "=", string(enc.padBytes))
+	default:
+		oldnew = append(oldnew, "=", string(enc.padBytes))
+	}
+	return strings.NewReplacer(oldnew...)
+}
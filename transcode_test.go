@@ -0,0 +1,104 @@
+package base64dq
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestTranscode(t *testing.T) {
+	for _, p := range pairs {
+		katakana := hiragana2katakana(p.encoded)
+		for _, tt := range []struct {
+			dst, src *Encoding
+			in, want string
+		}{
+			{KatakanaEncoding, StdEncoding, p.encoded, katakana},
+			{StdEncoding, KatakanaEncoding, katakana, p.encoded},
+			{RawKatakanaEncoding, StdEncoding, p.encoded, rawRef(katakana)},
+			{KatakanaEncoding, RawStdEncoding, rawRef(p.encoded), katakana},
+			{RawKatakanaEncoding, RawStdEncoding, rawRef(p.encoded), rawRef(katakana)},
+		} {
+			got, err := Transcode(tt.dst, tt.src, tt.in)
+			if err != nil {
+				t.Errorf("Transcode(%q) = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Transcode(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			decoded, err := tt.dst.DecodeString(got)
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", got, err)
+			}
+			if string(decoded) != p.decoded {
+				t.Errorf("Decode(%q) = %q, want %q", got, decoded, p.decoded)
+			}
+		}
+	}
+}
+
+func TestTranscode_Corrupt(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		want   string
+		offset int // -1 means no corruption.
+	}{
+		{"", "", -1},
+		{"はむ\r\n・・\n", "ハム\r\n・・\n", -1},
+		{"はむア・", "", len("はむ")},
+		{"はむ・あ", "", len("はむ・")},
+		{"はむ\xe3\x81", "", len("はむ")},
+	} {
+		got, err := Transcode(KatakanaEncoding, StdEncoding, tc.input)
+		if tc.offset == -1 {
+			if err != nil {
+				t.Errorf("Transcode(%q) = %v", tc.input, err)
+			}
+			if got != tc.want {
+				t.Errorf("Transcode(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+		} else if errOffset(err) != tc.offset {
+			t.Errorf("Transcode(%q) error = %v, want CorruptInputError(%d)", tc.input, err, tc.offset)
+		}
+	}
+}
+
+func TestStdReplacer(t *testing.T) {
+	for _, p := range pairs {
+		std := base64.StdEncoding.EncodeToString([]byte(p.decoded))
+		if got, want := StdEncoding.FromStdReplacer().Replace(std), std2dq.Replace(std); got != want {
+			t.Errorf("FromStdReplacer().Replace(%q) = %q, want %q", std, got, want)
+		}
+		if got, want := StdEncoding.ToStdReplacer().Replace(p.encoded), dq2std.Replace(p.encoded); got != want {
+			t.Errorf("ToStdReplacer().Replace(%q) = %q, want %q", p.encoded, got, want)
+		}
+
+		for _, tt := range encodingTests {
+			encoded := tt.conv(p.encoded)
+			got := tt.enc.ToStdReplacer().Replace(encoded)
+			want := std
+			if tt.enc.PaddingChar() == NoPadding {
+				want = base64.RawStdEncoding.EncodeToString([]byte(p.decoded))
+			}
+			if got != want {
+				t.Errorf("%v: ToStdReplacer().Replace(%q) = %q, want %q", tt.enc, encoded, got, want)
+			}
+			if got := tt.enc.FromStdReplacer().Replace(std); got != encoded {
+				t.Errorf("%v: FromStdReplacer().Replace(%q) = %q, want %q", tt.enc, std, got, encoded)
+			}
+		}
+	}
+}
+
+func TestFromStdReplacer_SinglePadding(t *testing.T) {
+	enc := StdEncoding.WithSinglePadding()
+	for _, p := range pairs {
+		std := base64.StdEncoding.EncodeToString([]byte(p.decoded))
+		got := enc.FromStdReplacer().Replace(std)
+		if want := enc.EncodeToString([]byte(p.decoded)); got != want {
+			t.Errorf("FromStdReplacer().Replace(%q) = %q, want %q", std, got, want)
+		}
+		if _, err := enc.DecodeString(got); err != nil {
+			t.Errorf("DecodeString(%q) error = %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package base64dq
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrOverflow is returned by DecodeUint64 when the decoded data is longer than 8 bytes.
+var ErrOverflow = errors.New("base64dq: value overflows uint64")
+
+// EncodeUint64 returns the base64dq encoding of v as big-endian bytes.
+// The leading zero bytes are trimmed, but at least one byte is encoded.
+func (enc *Encoding) EncodeUint64(v uint64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	i := 0
+	for i < len(buf)-1 && buf[i] == 0 {
+		i++
+	}
+	return enc.EncodeToString(buf[i:])
+}
+
+// DecodeUint64 returns the integer represented by the base64dq string s
+// as big-endian bytes, encoded by EncodeUint64.
+// If the decoded data is longer than 8 bytes, it returns ErrOverflow.
+func (enc *Encoding) DecodeUint64(s string) (uint64, error) {
+	var buf [8 + 1]byte // one more byte for the checksum
+	size := 8
+	if enc.checksum != nil {
+		size++
+	}
+	if enc.DecodedLenString(s) > size {
+		if err := enc.Validate(s); err != nil {
+			return 0, err
+		}
+		return 0, ErrOverflow
+	}
+	n, err := decode(enc, buf[:], s, true, nil)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range buf[:n] {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
@@ -0,0 +1,54 @@
+package base64dq
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEncodeUint64(t *testing.T) {
+	for _, tt := range []struct {
+		v    uint64
+		want string
+	}{
+		{0, StdEncoding.EncodeToString([]byte{0})},
+		{0xff, StdEncoding.EncodeToString([]byte{0xff})},
+		{0x100, StdEncoding.EncodeToString([]byte{0x01, 0x00})},
+		{0x666f6f626172, StdEncoding.EncodeToString([]byte("foobar"))},
+		{math.MaxUint64, StdEncoding.EncodeToString([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})},
+	} {
+		got := StdEncoding.EncodeUint64(tt.v)
+		if got != tt.want {
+			t.Errorf("EncodeUint64(%#x) = %q, want %q", tt.v, got, tt.want)
+		}
+		v, err := StdEncoding.DecodeUint64(got)
+		if err != nil {
+			t.Errorf("DecodeUint64(%q) error = %v", got, err)
+		}
+		if v != tt.v {
+			t.Errorf("DecodeUint64(%q) = %#x, want %#x", got, v, tt.v)
+		}
+	}
+}
+
+func TestDecodeUint64(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want uint64
+		err  error
+	}{
+		{"", 0, nil},
+		{StdEncoding.EncodeToString([]byte{0, 0, 1}), 1, nil},
+		{StdEncoding.EncodeToString(make([]byte, 9)), 0, ErrOverflow},
+		{"ああ・あ", 0, ErrInvalidRune},
+		{"ああああああああああああああ・あ", 0, ErrInvalidRune},
+	} {
+		got, err := StdEncoding.DecodeUint64(tt.s)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("DecodeUint64(%q) error = %v, want %v", tt.s, err, tt.err)
+		}
+		if got != tt.want {
+			t.Errorf("DecodeUint64(%q) = %#x, want %#x", tt.s, got, tt.want)
+		}
+	}
+}
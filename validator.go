@@ -0,0 +1,93 @@
+package base64dq
+
+import "io"
+
+// NewValidator returns an io.WriteCloser that validates the base64dq data written to it
+// without producing output.
+// Write returns the same error as Decode at the first invalid rune,
+// and Close performs the final padding and length checks.
+// Once an error is returned, the following calls return the same error.
+//
+// For example, io.Copy(NewValidator(enc), r) validates r, stopping at the first problem.
+// If the encoding has a checksum, the validator keeps the decoded data to verify it on Close.
+func NewValidator(enc *Encoding) io.WriteCloser {
+	v := &validator{enc: enc}
+	v.d = NewDecoder(enc.withoutChecksum(), &v.in).(*decoder)
+	return v
+}
+
+type validator struct {
+	enc  *Encoding
+	d    *decoder
+	in   validatorInput
+	out  [3 * 1024]byte // scratch buffer for the decoded data
+	data []byte         // decoded data for the checksum
+	err  error
+}
+
+// validatorInput serves the data of the current Write to the decoder.
+// It is paused when the data runs out, until the next Write or Close.
+type validatorInput struct {
+	p   []byte
+	eof bool
+}
+
+func (in *validatorInput) Read(p []byte) (int, error) {
+	if len(in.p) == 0 && in.eof {
+		return 0, io.EOF
+	}
+	n := copy(p, in.p)
+	in.p = in.p[n:]
+	return n, nil
+}
+
+func (in *validatorInput) paused() bool {
+	return len(in.p) == 0 && !in.eof
+}
+
+func (v *validator) Write(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	v.in.p = p
+	if err := v.run(); err != nil {
+		v.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (v *validator) Close() error {
+	if v.err != nil {
+		return v.err
+	}
+	v.in.eof = true
+	err := v.run()
+	if err == io.EOF {
+		err = nil
+		if v.enc.checksum != nil {
+			_, err = v.enc.verifyChecksum(v.data)
+		}
+	}
+	if err != nil {
+		v.err = err
+	}
+	return err
+}
+
+// run decodes the available input.
+func (v *validator) run() error {
+	for {
+		n, err := v.d.Read(v.out[:])
+		if v.enc.checksum != nil {
+			v.data = append(v.data, v.out[:n]...)
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 && v.d.paused() {
+			// the decoder has consumed the written data.
+			return nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package base64dq
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// validate writes s to a validator in chunks of size bytes.
+func validate(enc *Encoding, s string, size int) error {
+	v := NewValidator(enc)
+	for i := 0; i < len(s); i += size {
+		end := i + size
+		if end > len(s) {
+			end = len(s)
+		}
+		if _, err := io.WriteString(v, s[i:end]); err != nil {
+			return err
+		}
+	}
+	return v.Close()
+}
+
+func TestValidator(t *testing.T) {
+	encodings := []*Encoding{
+		StdEncoding,
+		RawStdEncoding,
+		StdEncoding.Strict(),
+		StdEncoding.WithKanaComposition(),
+		StdEncoding.WithIgnoreInvalid(),
+		StdEncoding.WithSkipBOM(),
+		StdEncoding.WithConcatenated(),
+	}
+	var inputs []string
+	for _, p := range pairs {
+		inputs = append(inputs, p.encoded)
+	}
+	for _, tc := range decodeCorruptTestCases {
+		inputs = append(inputs, tc.input)
+	}
+	inputs = append(inputs, "は゛らふ゛け゛", "\uFEFFはらぶげ", "はむ・・はむ・・", "はら-ぶげ")
+
+	for _, enc := range encodings {
+		for _, input := range inputs {
+			want := fmt.Sprintf("%#v", enc.Validate(input))
+			for _, size := range []int{1, 2, 3, 5, 1000} {
+				if got := fmt.Sprintf("%#v", validate(enc, input, size)); got != want {
+					t.Errorf("%v: validate(%q, %d) = %s, want %s", enc, input, size, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestValidator_Checksum(t *testing.T) {
+	enc := StdEncoding.WithChecksum(xorSum)
+	for _, input := range []string{
+		enc.EncodeToString([]byte(bigtest.decoded)),
+		StdEncoding.EncodeToString([]byte(bigtest.decoded)),
+		"",
+	} {
+		want := fmt.Sprintf("%#v", enc.Validate(input))
+		if got := fmt.Sprintf("%#v", validate(enc, input, 7)); got != want {
+			t.Errorf("validate(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestValidator_Copy(t *testing.T) {
+	input := strings.Repeat("はらぶげ", 10000) + "!" + strings.Repeat("はらぶげ", 10000)
+	v := NewValidator(StdEncoding)
+	_, err := io.Copy(v, strings.NewReader(input))
+	if want := StdEncoding.Validate(input); fmt.Sprint(err) != fmt.Sprint(want) {
+		t.Errorf("io.Copy error = %v, want %v", err, want)
+	}
+	if err2 := v.Close(); err2 != err {
+		t.Errorf("Close error = %v, want %v", err2, err)
+	}
+}
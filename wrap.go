@@ -0,0 +1,164 @@
+package base64dq
+
+import "io"
+
+// NewEncoderWithWrap returns a new base64 stream encoder
+// that breaks the output into lines of lineLen runes separated by sep.
+// sep is not written after the last line.
+// If lineLen <= 0, the output is not wrapped.
+//
+// sep should consist of runes that the decoder ignores, typically "\n" or "\r\n",
+// so that the output can be decoded by NewDecoder.
+func NewEncoderWithWrap(enc *Encoding, w io.Writer, lineLen int, sep string) io.WriteCloser {
+	if lineLen <= 0 {
+		return NewEncoder(enc, w)
+	}
+	return newWrapEncoder(enc, &lineBreaker{w: w, lineLen: lineLen, sep: sep})
+}
+
+// NewEncoderWithGroupWrap returns a new base64 stream encoder
+// that writes sep after the output of every groupLen bytes of input,
+// e.g. one line per 15-byte password record.
+// The input bytes are counted across Write calls.
+// If groupLen is not a multiple of 3, the separator is written after
+// the block containing the last byte of the group, so that no block is split.
+// sep is not written after the last group.
+// If groupLen <= 0, the output is not wrapped.
+//
+// sep should consist of runes that the decoder ignores, typically "\n" or "\r\n",
+// so that the output can be decoded by NewDecoder.
+func NewEncoderWithGroupWrap(enc *Encoding, w io.Writer, groupLen int, sep string) io.WriteCloser {
+	if groupLen <= 0 {
+		return NewEncoder(enc, w)
+	}
+	return newWrapEncoder(enc, &lineBreaker{w: w, groupLen: groupLen, sep: sep})
+}
+
+// NewEncoderWithTrailer returns a new base64 stream encoder
+// that writes trailer to w once on Close, after the final block.
+// trailer is typically "\n" for terminal display;
+// it should consist of runes that the decoder ignores,
+// so that the output can be decoded by NewDecoder.
+func NewEncoderWithTrailer(enc *Encoding, w io.Writer, trailer string) io.WriteCloser {
+	return &trailerEncoder{e: NewEncoder(enc, w).(Encoder), w: w, trailer: trailer}
+}
+
+// trailerEncoder writes the trailer after the encoded data.
+type trailerEncoder struct {
+	e       Encoder
+	w       io.Writer
+	trailer string
+	closed  bool // whether the trailer has been written
+}
+
+func (t *trailerEncoder) Write(p []byte) (int, error) {
+	return t.e.Write(p)
+}
+
+func (t *trailerEncoder) Close() error {
+	if err := t.e.Close(); err != nil {
+		return err
+	}
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	_, err := io.WriteString(t.w, t.trailer)
+	return err
+}
+
+func (t *trailerEncoder) Flush() error {
+	return t.e.Flush()
+}
+
+func (t *trailerEncoder) Reset(w io.Writer) {
+	t.e.Reset(w)
+	t.w = w
+	t.closed = false
+}
+
+// wrapEncoder is the stream encoder writing to a lineBreaker.
+type wrapEncoder struct {
+	e Encoder
+	l *lineBreaker
+}
+
+func newWrapEncoder(enc *Encoding, l *lineBreaker) *wrapEncoder {
+	return &wrapEncoder{e: NewEncoder(enc, l).(Encoder), l: l}
+}
+
+func (e *wrapEncoder) Write(p []byte) (int, error) {
+	return e.e.Write(p)
+}
+
+func (e *wrapEncoder) Close() error {
+	return e.e.Close()
+}
+
+func (e *wrapEncoder) Flush() error {
+	return e.e.Flush()
+}
+
+// Reset makes the encoder write to w, starting a new line.
+func (e *wrapEncoder) Reset(w io.Writer) {
+	e.l.w = w
+	e.l.col = 0
+	e.l.line = 0
+	e.e.Reset(e.l)
+}
+
+// lineBreaker inserts a separator after every lineLen runes,
+// or after the runes of every groupLen bytes of input if groupLen > 0.
+type lineBreaker struct {
+	w        io.Writer
+	lineLen  int
+	groupLen int
+	sep      string
+	col      int // number of runes in the current line
+	line     int // number of the separators written
+}
+
+// limit returns the number of runes in the current line.
+func (l *lineBreaker) limit() int {
+	if l.groupLen <= 0 {
+		return l.lineLen
+	}
+	// each block of 3 input bytes is encoded into 4 runes.
+	blocks := func(line int) int { return (line*l.groupLen + 2) / 3 }
+	return 4 * (blocks(l.line+1) - blocks(l.line))
+}
+
+func (l *lineBreaker) Write(p []byte) (n int, err error) {
+	start := 0
+	for i, b := range p {
+		if !isRuneStart(b) {
+			continue
+		}
+		if l.col == l.limit() {
+			if _, err := l.w.Write(p[start:i]); err != nil {
+				return start, err
+			}
+			if _, err := io.WriteString(l.w, l.sep); err != nil {
+				return i, err
+			}
+			start = i
+			l.col = 0
+			l.line++
+		}
+		l.col++
+	}
+	if _, err := l.w.Write(p[start:]); err != nil {
+		return start, err
+	}
+	return len(p), nil
+}
+
+// Flush flushes the underlying writer.
+func (l *lineBreaker) Flush() error {
+	return flush(l.w)
+}
+
+// isRuneStart reports whether the byte could be the first byte of an encoded rune.
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,211 @@
+package base64dq
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncoderWithWrap(t *testing.T) {
+	for _, tt := range []struct {
+		lineLen int
+		sep     string
+		want    string
+	}{
+		{0, "\n", bigtest.encoded},
+		{-1, "\n", bigtest.encoded},
+		{
+			20, "\n",
+			"にくほめへじいもへらよがふきよりしういめ\n" +
+				"ふらちむほきめよけくせがひねつるまていぜ\n" +
+				"ふぢはよへご・・",
+		},
+		{
+			24, "\r\n",
+			"にくほめへじいもへらよがふきよりしういめふらちむ\r\n" +
+				"ほきめよけくせがひねつるまていぜふぢはよへご・・",
+		},
+	} {
+		input := []byte(bigtest.decoded)
+		for bs := 1; bs <= 12; bs++ {
+			bb := &strings.Builder{}
+			encoder := NewEncoderWithWrap(StdEncoding, bb, tt.lineLen, tt.sep)
+			for pos := 0; pos < len(input); pos += bs {
+				end := pos + bs
+				if end > len(input) {
+					end = len(input)
+				}
+				if _, err := encoder.Write(input[pos:end]); err != nil {
+					t.Errorf("Write(%q) error: %v", input[pos:end], err)
+				}
+			}
+			if err := encoder.Close(); err != nil {
+				t.Error("Close gave error:", err)
+			}
+			if bb.String() != tt.want {
+				t.Errorf("Encoding/%d of %q = %q, want %q", bs, bigtest.decoded, bb.String(), tt.want)
+			}
+
+			decoded, err := io.ReadAll(NewDecoder(StdEncoding, strings.NewReader(bb.String())))
+			if err != nil {
+				t.Errorf("Decode(%q) error: %v", bb.String(), err)
+			}
+			if string(decoded) != bigtest.decoded {
+				t.Errorf("Decode(%q) = %q, want %q", bb.String(), decoded, bigtest.decoded)
+			}
+		}
+	}
+}
+
+func TestEncoderWithWrap_Flush(t *testing.T) {
+	bb := &strings.Builder{}
+	bw := bufio.NewWriter(bb)
+	encoder := NewEncoderWithWrap(StdEncoding, bw, 2, "\n").(Encoder)
+	if _, err := encoder.Write([]byte("foob")); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bb.String(), "はら\nぶげ"; got != want {
+		t.Errorf("after Flush() = %q, want %q", got, want)
+	}
+}
+
+func TestEncoderWithWrap_Reset(t *testing.T) {
+	var bb strings.Builder
+	encoder := NewEncoderWithWrap(StdEncoding, &bb, 20, "\n").(Encoder)
+	want := "にくほめへじいもへらよがふきよりしういめ\n" +
+		"ふらちむほきめよけくせがひねつるまていぜ\n" +
+		"ふぢはよへご・・"
+	for i := 0; i < 2; i++ {
+		// the second encoding starts a new line after Reset.
+		bb.Reset()
+		encoder.Reset(&bb)
+		if _, err := encoder.Write([]byte(bigtest.decoded)); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := bb.String(); got != want {
+			t.Errorf("encoding #%d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestEncoderWithGroupWrap(t *testing.T) {
+	for _, tt := range []struct {
+		groupLen int
+		want     string
+	}{
+		{0, bigtest.encoded},
+		{-1, bigtest.encoded},
+		{
+			15,
+			"にくほめへじいもへらよがふきよりしういめ\n" +
+				"ふらちむほきめよけくせがひねつるまていぜ\n" +
+				"ふぢはよへご・・",
+		},
+		{
+			// the separators are written after the blocks containing 7th, 14th, ... bytes.
+			7,
+			"にくほめへじいもへらよが\n" +
+				"ふきよりしういめ\n" +
+				"ふらちむほきめよ\n" +
+				"けくせがひねつるまていぜ\n" +
+				"ふぢはよへご・・",
+		},
+		{len(bigtest.decoded), bigtest.encoded},
+	} {
+		input := []byte(bigtest.decoded)
+		for bs := 1; bs <= 12; bs++ {
+			bb := &strings.Builder{}
+			encoder := NewEncoderWithGroupWrap(StdEncoding, bb, tt.groupLen, "\n")
+			for pos := 0; pos < len(input); pos += bs {
+				end := pos + bs
+				if end > len(input) {
+					end = len(input)
+				}
+				if _, err := encoder.Write(input[pos:end]); err != nil {
+					t.Errorf("Write(%q) error: %v", input[pos:end], err)
+				}
+			}
+			if err := encoder.Close(); err != nil {
+				t.Error("Close gave error:", err)
+			}
+			if bb.String() != tt.want {
+				t.Errorf("Encoding/%d of %q = %q, want %q", bs, bigtest.decoded, bb.String(), tt.want)
+			}
+
+			decoded, err := io.ReadAll(NewDecoder(StdEncoding, strings.NewReader(bb.String())))
+			if err != nil {
+				t.Errorf("Decode(%q) error: %v", bb.String(), err)
+			}
+			if string(decoded) != bigtest.decoded {
+				t.Errorf("Decode(%q) = %q, want %q", bb.String(), decoded, bigtest.decoded)
+			}
+		}
+	}
+}
+
+func TestEncoderWithGroupWrap_Reset(t *testing.T) {
+	var bb strings.Builder
+	encoder := NewEncoderWithGroupWrap(StdEncoding, &bb, 7, "\n").(Encoder)
+	want := "にくほめへじいもへらよが\n" +
+		"ふきよりしういめ\n" +
+		"ふらちむほきめよ\n" +
+		"けくせがひねつるまていぜ\n" +
+		"ふぢはよへご・・"
+	for i := 0; i < 2; i++ {
+		// the input bytes are counted from the start again after Reset.
+		bb.Reset()
+		encoder.Reset(&bb)
+		if _, err := encoder.Write([]byte(bigtest.decoded)); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := bb.String(); got != want {
+			t.Errorf("encoding #%d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestEncoderWithTrailer(t *testing.T) {
+	for _, p := range pairs {
+		var bb strings.Builder
+		encoder := NewEncoderWithTrailer(StdEncoding, &bb, "\n")
+		if _, err := io.WriteString(encoder, p.decoded); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// the trailer is written only once.
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if want := p.encoded + "\n"; bb.String() != want {
+			t.Errorf("encoded %q = %q, want %q", p.decoded, bb.String(), want)
+		}
+
+		decoded, err := StdEncoding.DecodeString(bb.String())
+		if err != nil || string(decoded) != p.decoded {
+			t.Errorf("DecodeString(%q) = %q, %v, want %q", bb.String(), decoded, err, p.decoded)
+		}
+	}
+
+	// Reset writes the trailer again.
+	var bb strings.Builder
+	encoder := NewEncoderWithTrailer(StdEncoding, io.Discard, "\r\n").(Encoder)
+	encoder.Close()
+	encoder.Reset(&bb)
+	io.WriteString(encoder, "foo")
+	encoder.Close()
+	if want := "はらぶげ\r\n"; bb.String() != want {
+		t.Errorf("encoded = %q, want %q", bb.String(), want)
+	}
+}